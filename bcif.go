@@ -0,0 +1,532 @@
+package cif
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The data types of the ByteArray encoding of BinaryCIF.
+const (
+	bcifInt8    = 1
+	bcifInt16   = 2
+	bcifInt32   = 3
+	bcifUint8   = 4
+	bcifUint16  = 5
+	bcifUint32  = 6
+	bcifFloat32 = 32
+	bcifFloat64 = 33
+)
+
+// The values of a BinaryCIF mask, which marks omitted (".") and missing
+// ("?") values in a column.
+const (
+	bcifPresent = 0
+	bcifOmitted = 1
+	bcifMissing = 2
+)
+
+// ReadBinary reads BinaryCIF data (as distributed by the RCSB PDB and PDBe)
+// and returns it as a CIF value, just like Read. BinaryCIF is described at
+// https://github.com/molstar/BinaryCIF.
+//
+// BinaryCIF stores every category as a table of columns, where each column
+// is a typed array of numbers or strings compressed with a sequence of
+// encodings. All of the encodings of the specification are supported:
+// ByteArray, FixedPoint, IntervalQuantization, RunLength, Delta,
+// IntegerPacking and StringArray. Omitted (".") and missing ("?") values are
+// restored from the mask of each column.
+//
+// Columns of integers are []int, columns of floating point numbers are
+// []float64 and columns of strings are []string, regardless of their values.
+// As with Read, omitted and missing values in numeric columns are 0 (see
+// Texts). Floating point numbers stored with the FixedPoint encoding keep
+// the number of decimal places given by its factor in their text. e.g., 1.5
+// stored with a factor of 1000 has a text of "1.500".
+//
+// Since BinaryCIF does not distinguish tables from other data items,
+// categories with a single row are read as data items that are not in a
+// table, and categories with no rows are ignored. Data block names and data
+// tags are stored in lowercase, as they are by Read.
+func ReadBinary(r io.Reader) (_ *CIF, err error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(cifError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	d := &msgpackDecoder{buf: input}
+	file := bcifObject(d.decode(), "file")
+	if d.pos < len(d.buf) {
+		bcifErrf("Unexpected data after byte %d.", d.pos)
+	}
+	cif := &CIF{Blocks: make(map[string]*DataBlock, 1)}
+	for _, v := range bcifList(file, "dataBlocks") {
+		block := bcifObject(v, "data block")
+		name := strings.ToLower(bcifString(block, "header"))
+		if _, ok := cif.Blocks[name]; ok {
+			bcifErrf("Data block with name '%s' already exists.", name)
+		}
+		b := &DataBlock{
+			Block:  newBlock(name),
+			Frames: make(map[string]*SaveFrame, 0),
+		}
+		for _, cat := range bcifList(block, "categories") {
+			bcifCategory(&b.Block, bcifObject(cat, "category"))
+		}
+		cif.Blocks[name] = b
+		cif.order = append(cif.order, name)
+	}
+	return cif, nil
+}
+
+// bcifCategory adds the data items of a category to a block.
+func bcifCategory(b *Block, cat map[string]interface{}) {
+	name := strings.ToLower(strings.TrimPrefix(bcifString(cat, "name"), "_"))
+	rows := bcifInt(cat, "rowCount")
+	if rows == 0 {
+		return
+	}
+	cols := bcifList(cat, "columns")
+	lp := &Loop{
+		Columns: make(map[string]int, len(cols)),
+		Values:  make([]ValueLoop, len(cols)),
+	}
+	for i, v := range cols {
+		col := bcifObject(v, "column")
+		tag := name
+		if colName := bcifString(col, "name"); len(colName) > 0 {
+			tag += "." + strings.ToLower(colName)
+		}
+		if _, ok := b.Items[tag]; ok {
+			bcifErrf("Data item with name '%s' already exists in block '%s'.",
+				tag, b.Name)
+		}
+		if _, ok := b.Loops[tag]; ok {
+			bcifErrf("Data item with name '%s' already exists in block '%s'.",
+				tag, b.Name)
+		}
+		vals := bcifColumn(tag, col, rows)
+		if rows == 1 {
+			b.Items[tag] = bcifScalar(vals)
+		} else {
+			lp.Values[i] = vals
+			lp.Columns[tag] = i
+			b.Loops[tag] = lp
+		}
+		b.order = append(b.order, tag)
+	}
+}
+
+// bcifColumn decodes the values of a column with the number of rows given.
+func bcifColumn(tag string, col map[string]interface{}, rows int) ValueLoop {
+	data := bcifObject(bcifField(col, "data"), "data of "+tag)
+	vals, text := bcifDecode(data)
+	var mask []int
+	if m := col["mask"]; m != nil {
+		v, _ := bcifDecode(bcifObject(m, "mask of "+tag))
+		var ok bool
+		if mask, ok = v.([]int); !ok || len(mask) != rows {
+			bcifErrf("The mask of data tag '%s' is not an array of %d "+
+				"integers.", tag, rows)
+		}
+	}
+	null := func(i int) string {
+		if mask == nil {
+			return ""
+		}
+		switch mask[i] {
+		case bcifOmitted:
+			return "."
+		case bcifMissing:
+			return "?"
+		}
+		return ""
+	}
+
+	n := -1
+	var column ValueLoop
+	switch vals := vals.(type) {
+	case []string:
+		n = len(vals)
+		for i := 0; i < len(vals) && i < rows; i++ {
+			if s := null(i); len(s) > 0 {
+				vals[i] = s
+			}
+		}
+		column = cifStrings(vals)
+	case []int:
+		n = len(vals)
+		texts := make([]string, len(vals))
+		for i := 0; i < len(vals) && i < rows; i++ {
+			if texts[i] = null(i); len(texts[i]) > 0 {
+				vals[i] = 0
+			} else {
+				texts[i] = strconv.Itoa(vals[i])
+			}
+		}
+		column = cifInts{ints: vals, texts: texts}
+	case []float64:
+		n = len(vals)
+		texts := make([]string, len(vals))
+		for i := 0; i < len(vals) && i < rows; i++ {
+			if texts[i] = null(i); len(texts[i]) > 0 {
+				vals[i] = 0
+			} else {
+				texts[i] = text(vals[i])
+			}
+		}
+		column = cifFloats{floats: vals, texts: texts}
+	}
+	if n != rows {
+		bcifErrf("The data of data tag '%s' is not an array of %d numbers "+
+			"or strings.", tag, rows)
+	}
+	return column
+}
+
+// bcifScalar returns the first value of a column.
+func bcifScalar(vals ValueLoop) Value {
+	s := columnTexts(vals)[0]
+	if isNullText(s) {
+		return cifString(s)
+	}
+	switch vals := vals.(type) {
+	case cifInts:
+		return cifInt{n: vals.ints[0], text: s}
+	case cifFloats:
+		return cifFloat{f: vals.floats[0], text: s}
+	}
+	return cifString(s)
+}
+
+// bcifDecode decodes encoded data (an object with "encoding" and "data"),
+// applying its encodings in reverse. The array returned is a []byte, []int,
+// []float64 or []string. Also returned is a function that returns the text
+// of each floating point number in the array.
+func bcifDecode(
+	encoded map[string]interface{},
+) (interface{}, func(float64) string) {
+	var data interface{} = bcifBytes(encoded, "data")
+	encs := bcifList(encoded, "encoding")
+	for i := len(encs) - 1; i >= 0; i-- {
+		data = bcifApply(bcifObject(encs[i], "encoding"), data)
+	}
+
+	text := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if len(encs) > 0 {
+		enc := bcifObject(encs[0], "encoding")
+		switch bcifString(enc, "kind") {
+		case "ByteArray":
+			if bcifInt(enc, "type") == bcifFloat32 {
+				text = func(f float64) string {
+					return strconv.FormatFloat(f, 'f', -1, 32)
+				}
+			}
+		case "FixedPoint":
+			factor := bcifFloat(enc, "factor")
+			digits := math.Log10(factor)
+			if digits >= 0 && digits == math.Floor(digits) {
+				text = func(f float64) string {
+					return strconv.FormatFloat(f, 'f', int(digits), 64)
+				}
+			}
+		}
+	}
+	return data, text
+}
+
+// bcifApply decodes data with a single encoding.
+func bcifApply(enc map[string]interface{}, data interface{}) interface{} {
+	kind := bcifString(enc, "kind")
+	if kind == "StringArray" {
+		return bcifStringArray(enc, bcifBytesOf(kind, data))
+	}
+	if kind == "ByteArray" {
+		return bcifByteArray(bcifInt(enc, "type"), bcifBytesOf(kind, data))
+	}
+
+	ints, ok := data.([]int)
+	if !ok {
+		bcifErrf("The %s encoding must be applied to integers.", kind)
+	}
+	switch kind {
+	case "FixedPoint":
+		factor := bcifFloat(enc, "factor")
+		floats := make([]float64, len(ints))
+		for i, n := range ints {
+			floats[i] = float64(n) / factor
+		}
+		return floats
+	case "IntervalQuantization":
+		min, max := bcifFloat(enc, "min"), bcifFloat(enc, "max")
+		steps := bcifInt(enc, "numSteps")
+		delta := 0.0
+		if steps > 1 {
+			delta = (max - min) / float64(steps-1)
+		}
+		floats := make([]float64, len(ints))
+		for i, n := range ints {
+			floats[i] = min + delta*float64(n)
+		}
+		return floats
+	case "RunLength":
+		if len(ints)%2 != 0 {
+			bcifErrf("The RunLength encoding must have pairs of integers.")
+		}
+		size := bcifInt(enc, "srcSize")
+		var decoded []int
+		for i := 0; i < len(ints); i += 2 {
+			if ints[i+1] < 0 || ints[i+1] > size-len(decoded) {
+				bcifErrf("The RunLength encoding has more than %d values.",
+					size)
+			}
+			for j := 0; j < ints[i+1]; j++ {
+				decoded = append(decoded, ints[i])
+			}
+		}
+		if len(decoded) != size {
+			bcifErrf("The RunLength encoding has %d values instead of %d.",
+				len(decoded), size)
+		}
+		return decoded
+	case "Delta":
+		decoded := make([]int, len(ints))
+		prev := bcifInt(enc, "origin")
+		for i, n := range ints {
+			prev += n
+			decoded[i] = prev
+		}
+		return decoded
+	case "IntegerPacking":
+		return bcifUnpack(enc, ints)
+	}
+	bcifErrf("Unknown encoding '%s'.", kind)
+	panic("unreachable")
+}
+
+// bcifUnpack decodes the IntegerPacking encoding, where integers are stored
+// in 1 or 2 bytes and larger integers are sums of the limits of the smaller
+// integers.
+func bcifUnpack(enc map[string]interface{}, ints []int) []int {
+	var upper, lower int
+	unsigned := bcifField(enc, "isUnsigned") == true
+	switch bcifInt(enc, "byteCount") {
+	case 1:
+		upper, lower = math.MaxInt8, math.MinInt8
+		if unsigned {
+			upper, lower = math.MaxUint8, 0
+		}
+	case 2:
+		upper, lower = math.MaxInt16, math.MinInt16
+		if unsigned {
+			upper, lower = math.MaxUint16, 0
+		}
+	default:
+		bcifErrf("The IntegerPacking encoding must use 1 or 2 bytes.")
+	}
+	size := bcifInt(enc, "srcSize")
+	decoded := make([]int, 0, len(ints))
+	for i := 0; i < len(ints); i++ {
+		n := 0
+		for (ints[i] == upper || (!unsigned && ints[i] == lower)) &&
+			i+1 < len(ints) {
+
+			n += ints[i]
+			i++
+		}
+		decoded = append(decoded, n+ints[i])
+	}
+	if len(decoded) != size {
+		bcifErrf("The IntegerPacking encoding has %d values instead of %d.",
+			len(decoded), size)
+	}
+	return decoded
+}
+
+// bcifStringArray decodes the StringArray encoding, where each string is an
+// index into a list of distinct strings (or -1 for an empty string).
+func bcifStringArray(enc map[string]interface{}, data []byte) []string {
+	all := bcifString(enc, "stringData")
+	offsets := bcifIntsOf("offsets", map[string]interface{}{
+		"encoding": bcifField(enc, "offsetEncoding"),
+		"data":     bcifField(enc, "offsets"),
+	})
+	indices := bcifIntsOf("indices", map[string]interface{}{
+		"encoding": bcifField(enc, "dataEncoding"),
+		"data":     data,
+	})
+	if len(offsets) == 0 {
+		bcifErrf("The StringArray encoding has no offsets.")
+	}
+
+	strs := make([]string, len(offsets)-1)
+	for i := range strs {
+		start, end := offsets[i], offsets[i+1]
+		if start < 0 || start > end || end > len(all) {
+			bcifErrf("The StringArray encoding has an invalid offset.")
+		}
+		strs[i] = all[start:end]
+	}
+	decoded := make([]string, len(indices))
+	for i, index := range indices {
+		switch {
+		case index == -1:
+		case index < 0 || index >= len(strs):
+			bcifErrf("The StringArray encoding has an invalid index %d.",
+				index)
+		default:
+			decoded[i] = strs[index]
+		}
+	}
+	return decoded
+}
+
+// bcifByteArray decodes the ByteArray encoding, where numbers are stored in
+// little-endian order.
+func bcifByteArray(typ int, data []byte) interface{} {
+	size := map[int]int{
+		bcifInt8: 1, bcifUint8: 1, bcifInt16: 2, bcifUint16: 2,
+		bcifInt32: 4, bcifUint32: 4, bcifFloat32: 4, bcifFloat64: 8,
+	}[typ]
+	if size == 0 {
+		bcifErrf("Unknown ByteArray type %d.", typ)
+	}
+	if len(data)%size != 0 {
+		bcifErrf("The ByteArray data is not a multiple of %d bytes.", size)
+	}
+	n := len(data) / size
+	le := binary.LittleEndian
+	if typ == bcifFloat32 || typ == bcifFloat64 {
+		floats := make([]float64, n)
+		for i := range floats {
+			if typ == bcifFloat32 {
+				floats[i] = float64(math.Float32frombits(le.Uint32(data[4*i:])))
+			} else {
+				floats[i] = math.Float64frombits(le.Uint64(data[8*i:]))
+			}
+		}
+		return floats
+	}
+	ints := make([]int, n)
+	for i := range ints {
+		switch typ {
+		case bcifInt8:
+			ints[i] = int(int8(data[i]))
+		case bcifUint8:
+			ints[i] = int(data[i])
+		case bcifInt16:
+			ints[i] = int(int16(le.Uint16(data[2*i:])))
+		case bcifUint16:
+			ints[i] = int(le.Uint16(data[2*i:]))
+		case bcifInt32:
+			ints[i] = int(int32(le.Uint32(data[4*i:])))
+		case bcifUint32:
+			ints[i] = int(le.Uint32(data[4*i:]))
+		}
+	}
+	return ints
+}
+
+// bcifBytesOf returns decoded data that must be binary data for an encoding.
+func bcifBytesOf(kind string, data interface{}) []byte {
+	b, ok := data.([]byte)
+	if !ok {
+		bcifErrf("The %s encoding must be applied to binary data.", kind)
+	}
+	return b
+}
+
+// bcifIntsOf decodes the offsets or indices of the StringArray encoding,
+// which must be integers.
+func bcifIntsOf(what string, encoded map[string]interface{}) []int {
+	data, _ := bcifDecode(encoded)
+	ints, ok := data.([]int)
+	if !ok {
+		bcifErrf("The %s of the StringArray encoding must be integers.", what)
+	}
+	return ints
+}
+
+// bcifObject returns a value that must be a map.
+func bcifObject(v interface{}, what string) map[string]interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		bcifErrf("Expected the %s to be a map.", what)
+	}
+	return m
+}
+
+// bcifField returns the value of a field that must be in a map.
+func bcifField(m map[string]interface{}, key string) interface{} {
+	v, ok := m[key]
+	if !ok {
+		bcifErrf("The field '%s' is missing.", key)
+	}
+	return v
+}
+
+// bcifList returns the value of a field that must be an array.
+func bcifList(m map[string]interface{}, key string) []interface{} {
+	v, ok := bcifField(m, key).([]interface{})
+	if !ok {
+		bcifErrf("The field '%s' must be an array.", key)
+	}
+	return v
+}
+
+// bcifString returns the value of a field that must be a string.
+func bcifString(m map[string]interface{}, key string) string {
+	v, ok := bcifField(m, key).(string)
+	if !ok {
+		bcifErrf("The field '%s' must be a string.", key)
+	}
+	return v
+}
+
+// bcifBytes returns the value of a field that must be binary data.
+func bcifBytes(m map[string]interface{}, key string) []byte {
+	v, ok := bcifField(m, key).([]byte)
+	if !ok {
+		bcifErrf("The field '%s' must be binary data.", key)
+	}
+	return v
+}
+
+// bcifInt returns the value of a field that must be an integer.
+func bcifInt(m map[string]interface{}, key string) int {
+	v, ok := bcifField(m, key).(int64)
+	if !ok || int64(int(v)) != v {
+		bcifErrf("The field '%s' must be an integer.", key)
+	}
+	return int(v)
+}
+
+// bcifFloat returns the value of a field that must be a number.
+func bcifFloat(m map[string]interface{}, key string) float64 {
+	switch v := bcifField(m, key).(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	bcifErrf("The field '%s' must be a number.", key)
+	panic("unreachable")
+}
+
+func bcifErrf(format string, v ...interface{}) {
+	panic(cifError("BinaryCIF error: " + sf(format, v...)))
+}
@@ -0,0 +1,245 @@
+package cif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// msgpackDecoder decodes MessagePack data (http://msgpack.org), which is the
+// container format of BinaryCIF. Maps are decoded as map[string]interface{}
+// (BinaryCIF only uses string keys), arrays as []interface{}, binary data
+// as []byte, integers as int64, floats as float64 and nil as nil.
+//
+// Errors are reported with bcifErrf.
+type msgpackDecoder struct {
+	buf   []byte
+	pos   int
+	depth int // of the arrays and maps being decoded
+}
+
+// msgpackMaxDepth is the deepest nesting of arrays and maps that is decoded.
+// (BinaryCIF never nests them more than a few levels deep.)
+const msgpackMaxDepth = 32
+
+// decode decodes the next value.
+func (d *msgpackDecoder) decode() interface{} {
+	b := d.bytes(1)[0]
+	switch {
+	case b <= 0x7f:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b >= 0x80 && b <= 0x8f:
+		return d.decodeMap(int(b & 0x0f))
+	case b >= 0x90 && b <= 0x9f:
+		return d.decodeArray(int(b & 0x0f))
+	case b >= 0xa0 && b <= 0xbf:
+		return string(d.bytes(int(b & 0x1f)))
+	}
+	switch b {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xc4, 0xc5, 0xc6:
+		return d.bytes(d.length(b - 0xc4))
+	case 0xca:
+		return float64(math.Float32frombits(d.uint32()))
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(d.bytes(8)))
+	case 0xcc:
+		return int64(d.bytes(1)[0])
+	case 0xcd:
+		return int64(binary.BigEndian.Uint16(d.bytes(2)))
+	case 0xce:
+		return int64(d.uint32())
+	case 0xcf:
+		n := binary.BigEndian.Uint64(d.bytes(8))
+		if n > math.MaxInt64 {
+			bcifErrf("The integer %d is too large.", n)
+		}
+		return int64(n)
+	case 0xd0:
+		return int64(int8(d.bytes(1)[0]))
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(d.bytes(2))))
+	case 0xd2:
+		return int64(int32(d.uint32()))
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(d.bytes(8)))
+	case 0xd9, 0xda, 0xdb:
+		return string(d.bytes(d.length(b - 0xd9)))
+	case 0xdc, 0xdd:
+		return d.decodeArray(d.length(b - 0xdc + 1))
+	case 0xde, 0xdf:
+		return d.decodeMap(d.length(b - 0xde + 1))
+	}
+	bcifErrf("Unsupported MessagePack type 0x%02x at byte %d.", b, d.pos-1)
+	panic("unreachable")
+}
+
+// decodeArray decodes an array with n elements.
+func (d *msgpackDecoder) decodeArray(n int) []interface{} {
+	d.enter(n)
+	defer d.leave()
+	arr := make([]interface{}, n)
+	for i := range arr {
+		arr[i] = d.decode()
+	}
+	return arr
+}
+
+// decodeMap decodes a map with n entries.
+func (d *msgpackDecoder) decodeMap(n int) map[string]interface{} {
+	d.enter(2 * n)
+	defer d.leave()
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, ok := d.decode().(string)
+		if !ok {
+			bcifErrf("Expected a string map key before byte %d.", d.pos)
+		}
+		m[key] = d.decode()
+	}
+	return m
+}
+
+// enter starts decoding an array or map with n values. Since every value is
+// at least 1 byte long, n is checked against the bytes that remain before
+// anything is allocated for the values.
+func (d *msgpackDecoder) enter(n int) {
+	if n < 0 || n > len(d.buf)-d.pos {
+		bcifErrf("An array or map at byte %d has more values than there "+
+			"are bytes remaining.", d.pos)
+	}
+	if d.depth++; d.depth > msgpackMaxDepth {
+		bcifErrf("Arrays and maps are nested more than %d levels deep at "+
+			"byte %d.", msgpackMaxDepth, d.pos)
+	}
+}
+
+// leave finishes decoding an array or map.
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+// length reads a length that is 1, 2 or 4 bytes long (when size is 0, 1 or
+// 2).
+func (d *msgpackDecoder) length(size byte) int {
+	switch size {
+	case 0:
+		return int(d.bytes(1)[0])
+	case 1:
+		return int(binary.BigEndian.Uint16(d.bytes(2)))
+	}
+	return int(d.uint32())
+}
+
+// uint32 reads a 4 byte unsigned integer.
+func (d *msgpackDecoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.bytes(4))
+}
+
+// bytes returns the next n bytes.
+func (d *msgpackDecoder) bytes(n int) []byte {
+	if n < 0 || n > len(d.buf)-d.pos {
+		bcifErrf("Unexpected end of data at byte %d.", len(d.buf))
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+// msgpackEncode writes a value as MessagePack. The value must be nil, a
+// bool, an int, a float64, a string, a []byte, an []interface{} or a
+// map[string]interface{} (whose keys are written in sorted order, so that
+// the output is deterministic), where arrays and maps contain values of the
+// same types. Integers and lengths use their smallest encodings.
+func msgpackEncode(buf *bytes.Buffer, v interface{}) {
+	be := binary.BigEndian
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		switch {
+		case v >= 0 && v <= 0x7f, v < 0 && v >= -32:
+			buf.WriteByte(byte(v))
+		case v >= math.MinInt8 && v <= math.MaxInt8:
+			buf.Write([]byte{0xd0, byte(v)})
+		case v >= math.MinInt16 && v <= math.MaxInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, be, int16(v))
+		case v >= math.MinInt32 && v <= math.MaxInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, be, int32(v))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, be, int64(v))
+		}
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, be, math.Float64bits(v))
+	case string:
+		if len(v) < 32 {
+			buf.WriteByte(0xa0 | byte(len(v)))
+		} else {
+			msgpackLength(buf, len(v), 0xd9, 0xda, 0xdb)
+		}
+		buf.WriteString(v)
+	case []byte:
+		msgpackLength(buf, len(v), 0xc4, 0xc5, 0xc6)
+		buf.Write(v)
+	case []interface{}:
+		if len(v) < 16 {
+			buf.WriteByte(0x90 | byte(len(v)))
+		} else {
+			msgpackLength(buf, len(v), 0, 0xdc, 0xdd)
+		}
+		for _, el := range v {
+			msgpackEncode(buf, el)
+		}
+	case map[string]interface{}:
+		if len(v) < 16 {
+			buf.WriteByte(0x80 | byte(len(v)))
+		} else {
+			msgpackLength(buf, len(v), 0, 0xde, 0xdf)
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			msgpackEncode(buf, key)
+			msgpackEncode(buf, v[key])
+		}
+	default:
+		panic(sf("Type '%T' cannot be written as MessagePack.", v))
+	}
+}
+
+// msgpackLength writes the type and length of a string, binary data, array
+// or map, given its types with 1, 2 and 4 byte lengths. (Arrays and maps have
+// no type with a 1 byte length, which is given as 0.)
+func msgpackLength(buf *bytes.Buffer, n int, typ8, typ16, typ32 byte) {
+	switch {
+	case n <= math.MaxUint8 && typ8 != 0:
+		buf.Write([]byte{typ8, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(typ16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(typ32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
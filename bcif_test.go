@@ -0,0 +1,647 @@
+package cif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testMsgpack encodes a value as MessagePack, with the keys of maps in
+// sorted order.
+func testMsgpack(buf *bytes.Buffer, v interface{}) {
+	header := func(fix, b8 byte, n int) {
+		switch {
+		case n < 16 && fix != 0:
+			buf.WriteByte(fix | byte(n))
+		case n < 32 && fix == 0xa0:
+			buf.WriteByte(fix | byte(n))
+		default:
+			buf.WriteByte(b8 + 2)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, int64(v))
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		if len(v) < 32 {
+			header(0xa0, 0, len(v))
+		} else {
+			header(0, 0xd9, len(v))
+		}
+		buf.WriteString(v)
+	case []byte:
+		header(0, 0xc4, len(v))
+		buf.Write(v)
+	case []interface{}:
+		header(0x90, 0xdb, len(v))
+		for _, el := range v {
+			testMsgpack(buf, el)
+		}
+	case map[string]interface{}:
+		header(0x80, 0xdd, len(v))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			testMsgpack(buf, key)
+			testMsgpack(buf, v[key])
+		}
+	default:
+		panic(sf("Cannot encode %T.", v))
+	}
+}
+
+type obj map[string]interface{}
+type arr []interface{}
+
+// testEncoded returns encoded data for BinaryCIF, with the encodings given
+// in the order they were applied.
+func testEncoded(data interface{}, encs ...obj) obj {
+	list := make(arr, len(encs))
+	for i, enc := range encs {
+		list[i] = enc
+	}
+	return obj{"encoding": list, "data": data}
+}
+
+// testLE returns numbers in little-endian order.
+func testLE(nums interface{}) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, nums)
+	return buf.Bytes()
+}
+
+// testPlain converts obj and arr values to the plain maps and slices that
+// testMsgpack encodes.
+func testPlain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case obj:
+		m := make(map[string]interface{}, len(v))
+		for key, el := range v {
+			m[key] = testPlain(el)
+		}
+		return m
+	case arr:
+		list := make([]interface{}, len(v))
+		for i, el := range v {
+			list[i] = testPlain(el)
+		}
+		return list
+	}
+	return v
+}
+
+func testReadBinary(file obj) (*CIF, error) {
+	buf := new(bytes.Buffer)
+	testMsgpack(buf, testPlain(file))
+	return ReadBinary(buf)
+}
+
+func TestReadBinary(t *testing.T) {
+	byteArray := func(typ int) obj {
+		return obj{"kind": "ByteArray", "type": typ}
+	}
+	strArray := func(strs string, offsets []uint8, indices []int8) obj {
+		return testEncoded(testLE(indices), obj{
+			"kind":           "StringArray",
+			"dataEncoding":   arr{byteArray(bcifInt8)},
+			"stringData":     strs,
+			"offsetEncoding": arr{byteArray(bcifUint8)},
+			"offsets":        testLE(offsets),
+		})
+	}
+	mask := func(vals ...uint8) obj {
+		return testEncoded(testLE(vals), byteArray(bcifUint8))
+	}
+
+	file := obj{
+		"version": "0.3.0",
+		"encoder": "test",
+		"dataBlocks": arr{obj{
+			"header": "1ABC",
+			"categories": arr{
+				obj{
+					"name":     "_entry",
+					"rowCount": 1,
+					"columns": arr{obj{
+						"name": "id",
+						"data": strArray("1ABC", []uint8{0, 4},
+							[]int8{0}),
+						"mask": nil,
+					}},
+				},
+				obj{
+					"name":     "_empty",
+					"rowCount": 0,
+					"columns":  arr{},
+				},
+				obj{
+					"name":     "_atom_site",
+					"rowCount": 4,
+					"columns": arr{
+						obj{
+							"name": "id",
+							"data": testEncoded(testLE([]int8{0, 1, 1, 3}),
+								obj{
+									"kind": "Delta", "origin": 1,
+									"srcType": bcifInt32,
+								},
+								obj{
+									"kind": "RunLength", "srcSize": 4,
+									"srcType": bcifInt32,
+								},
+								obj{
+									"kind": "IntegerPacking", "byteCount": 1,
+									"isUnsigned": false, "srcSize": 4,
+								},
+								byteArray(bcifInt8)),
+						},
+						obj{
+							"name": "label_comp_id",
+							"data": strArray("ALAGLY", []uint8{0, 3, 6},
+								[]int8{0, 1, 0, -1}),
+							"mask": mask(0, 0, 0, 1),
+						},
+						obj{
+							"name": "Cartn_x",
+							"data": testEncoded(
+								testLE([]int32{1500, -2250, 100125, 0}),
+								obj{
+									"kind": "FixedPoint", "factor": 1000.0,
+									"srcType": bcifFloat64,
+								},
+								byteArray(bcifInt32)),
+							"mask": mask(0, 0, 0, 2),
+						},
+						obj{
+							"name": "occupancy",
+							"data": testEncoded(testLE([]uint8{0, 2, 4, 4}),
+								obj{
+									"kind": "IntervalQuantization",
+									"min":  0, "max": 1.0, "numSteps": 5,
+									"srcType": bcifFloat32,
+								},
+								byteArray(bcifUint8)),
+						},
+						obj{
+							"name": "B_iso_or_equiv",
+							"data": testEncoded(
+								testLE([]float32{1.1, 20.25, 3, 4}),
+								byteArray(bcifFloat32)),
+						},
+						obj{
+							"name": "pdbx_formal_charge",
+							"data": testEncoded(
+								testLE([]uint16{65535, 4465, 1, 2, 3}),
+								obj{
+									"kind": "IntegerPacking", "byteCount": 2,
+									"isUnsigned": true, "srcSize": 4,
+								},
+								byteArray(bcifUint16)),
+							"mask": mask(0, 0, 1, 0),
+						},
+					},
+				},
+			},
+		}},
+	}
+	cif, err := testReadBinary(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := cif.Blocks["1abc"]
+	if b == nil {
+		t.Fatalf("The data block '1abc' should be read.")
+	}
+	if v := b.Items["entry.id"]; v == nil || v.Raw() != "1ABC" {
+		t.Fatalf("The data item 'entry.id' should be '1ABC', but is %v.", v)
+	}
+	if _, ok := b.Items["empty.id"]; ok {
+		t.Fatalf("Categories without rows should be ignored.")
+	}
+
+	lp := b.Loops["atom_site.id"]
+	if lp == nil {
+		t.Fatalf("The table 'atom_site' should be read.")
+	}
+	tests := []struct {
+		tag   string
+		raw   interface{}
+		texts []string
+	}{
+		{"atom_site.id", []int{1, 2, 3, 4}, []string{"1", "2", "3", "4"}},
+		{"atom_site.label_comp_id", []string{"ALA", "GLY", "ALA", "."},
+			[]string{"ALA", "GLY", "ALA", "."}},
+		{"atom_site.cartn_x", []float64{1.5, -2.25, 100.125, 0},
+			[]string{"1.500", "-2.250", "100.125", "?"}},
+		{"atom_site.occupancy", []float64{0, 0.5, 1, 1},
+			[]string{"0", "0.5", "1", "1"}},
+		{"atom_site.b_iso_or_equiv",
+			[]float64{float64(float32(1.1)), 20.25, 3, 4},
+			[]string{"1.1", "20.25", "3", "4"}},
+		{"atom_site.pdbx_formal_charge", []int{70000, 1, 0, 3},
+			[]string{"70000", "1", ".", "3"}},
+	}
+	for _, test := range tests {
+		if b.Loops[test.tag] != lp {
+			t.Fatalf("The data tag '%s' should be in the table.", test.tag)
+		}
+		col := lp.Get(test.tag)
+		if !reflect.DeepEqual(col.Raw(), test.raw) {
+			t.Fatalf("The values of '%s' should be %v but are %v.",
+				test.tag, test.raw, col.Raw())
+		}
+		if !reflect.DeepEqual(Texts(col), test.texts) {
+			t.Fatalf("The texts of '%s' should be %v but are %v.",
+				test.tag, test.texts, Texts(col))
+		}
+	}
+
+	// The CIF read can be written as text.
+	buf := new(bytes.Buffer)
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "100.125") {
+		t.Fatalf("The CIF written should contain the coordinates:\n%s",
+			buf.String())
+	}
+}
+
+func TestReadBinaryErrors(t *testing.T) {
+	column := func(data obj) obj {
+		return obj{"dataBlocks": arr{obj{
+			"header": "test",
+			"categories": arr{obj{
+				"name":     "_test",
+				"rowCount": 2,
+				"columns":  arr{obj{"name": "x", "data": data}},
+			}},
+		}}}
+	}
+	tests := []struct {
+		file obj
+		err  string
+	}{
+		{obj{}, "The field 'dataBlocks' is missing."},
+		{column(testEncoded(testLE([]int8{1, 2}),
+			obj{"kind": "Unknown"},
+			obj{"kind": "ByteArray", "type": bcifInt8})),
+			"Unknown encoding 'Unknown'."},
+		{column(testEncoded(testLE([]int8{1, 2, 3}),
+			obj{"kind": "ByteArray", "type": bcifInt8})),
+			"The data of data tag 'test.x' is not an array of 2 numbers " +
+				"or strings."},
+		{column(testEncoded(testLE([]int16{1}),
+			obj{"kind": "ByteArray", "type": bcifInt32})),
+			"The ByteArray data is not a multiple of 4 bytes."},
+		{column(testEncoded(testLE([]int8{1, 2, 3}),
+			obj{"kind": "RunLength", "srcSize": 2},
+			obj{"kind": "ByteArray", "type": bcifInt8})),
+			"The RunLength encoding must have pairs of integers."},
+	}
+	for _, test := range tests {
+		_, err := testReadBinary(test.file)
+		if err == nil || err.Error() != "BinaryCIF error: "+test.err {
+			t.Fatalf("Reading should fail with '%s', but got '%v'.",
+				test.err, err)
+		}
+	}
+	if _, err := ReadBinary(bytes.NewReader([]byte{0x81, 0xa1})); err == nil {
+		t.Fatalf("Reading truncated data should fail.")
+	}
+
+	// Lengths and nesting are checked before anything is allocated.
+	deep := append(bytes.Repeat([]byte{0x91}, 100), 0xc0)
+	crafted := []struct {
+		data []byte
+		err  string
+	}{
+		{[]byte{0xdd, 0x7f, 0xff, 0xff, 0xff}, "An array or map at byte 5 " +
+			"has more values than there are bytes remaining."},
+		{[]byte{0xdf, 0x00, 0x00, 0x00, 0x03, 0xa1, 'a', 0xc0},
+			"An array or map at byte 5 has more values than there are " +
+				"bytes remaining."},
+		{deep, "Arrays and maps are nested more than 32 levels deep at " +
+			"byte 33."},
+	}
+	for _, test := range crafted {
+		_, err := ReadBinary(bytes.NewReader(test.data))
+		if err == nil || err.Error() != "BinaryCIF error: "+test.err {
+			t.Fatalf("Reading % x should fail with '%s', but got '%v'.",
+				test.data, test.err, err)
+		}
+	}
+}
+
+// testFixture is a small BinaryCIF file, byte for byte, laid out the way the
+// Mol* encoder writes one rather than the way testMsgpack or WriteBinary
+// would: map keys are in insertion order instead of sorted, and numbers use
+// the smallest types that hold them (like 0xcd for the FixedPoint factor
+// 1000). It has a single table, _atom_site, with the columns id (Int32),
+// type_symbol (StringArray) and Cartn_x (FixedPoint and Int32).
+const testFixture = "" +
+	"83a7656e636f646572a766697874757265a776657273696f6ea5302e332e30aa" +
+	"64617461426c6f636b739182a6686561646572a431414243aa63617465676f72" +
+	"6965739183a46e616d65aa5f61746f6d5f73697465a7636f6c756d6e739383a4" +
+	"6e616d65a26964a46461746182a8656e636f64696e679182a46b696e64a94279" +
+	"74654172726179a47479706503a464617461c4080100000002000000a46d6173" +
+	"6bc083a46e616d65ab747970655f73796d626f6ca46461746182a8656e636f64" +
+	"696e679185a46b696e64ab537472696e674172726179ac64617461456e636f64" +
+	"696e679182a46b696e64a9427974654172726179a47479706501aa737472696e" +
+	"6744617461a2434eae6f6666736574456e636f64696e679182a46b696e64a942" +
+	"7974654172726179a47479706501a76f666673657473c403000102a464617461" +
+	"c4020001a46d61736bc083a46e616d65a7436172746e5f78a46461746182a865" +
+	"6e636f64696e679283a46b696e64aa4669786564506f696e74a6666163746f72" +
+	"cd03e8a7737263547970652182a46b696e64a9427974654172726179a4747970" +
+	"6503a464617461c408dc05000036f7ffffa46d61736bc0a8726f77436f756e74" +
+	"02"
+
+func TestReadBinaryFixture(t *testing.T) {
+	data, err := hex.DecodeString(testFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cif, err := ReadBinary(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := cif.Blocks["1abc"]
+	if b == nil || b.Loops["atom_site.id"] == nil {
+		t.Fatalf("The table 'atom_site' should be read.")
+	}
+	lp := b.Loops["atom_site.id"]
+	tests := []struct {
+		tag string
+		raw interface{}
+	}{
+		{"atom_site.id", []int{1, 2}},
+		{"atom_site.type_symbol", []string{"C", "N"}},
+		{"atom_site.cartn_x", []float64{1.5, -2.25}},
+	}
+	for _, test := range tests {
+		if b.Loops[test.tag] != lp {
+			t.Fatalf("The data tag '%s' should be in the table.", test.tag)
+		}
+		if raw := lp.Get(test.tag).Raw(); !reflect.DeepEqual(raw, test.raw) {
+			t.Fatalf("The values of '%s' should be %v but are %v.",
+				test.tag, test.raw, raw)
+		}
+	}
+}
+
+// TestMsgpack checks both MessagePack encoders against the decoder, with
+// values large enough to need every type with a 4 byte length.
+func TestMsgpack(t *testing.T) {
+	many := make([]interface{}, 20)
+	fields := make(map[string]interface{}, 20)
+	for i := range many {
+		many[i] = []int{0, 127, -32, 200, -100, 300, -300, 70000, -70000,
+			1 << 40, -1 << 40}[i%11]
+		fields[sf("f%02d", i)] = i
+	}
+	v := map[string]interface{}{
+		"nil":    nil,
+		"true":   true,
+		"false":  false,
+		"float":  1.5,
+		"long":   strings.Repeat("x", 40),
+		"bin":    []byte{1, 2, 3},
+		"many":   many,
+		"fields": fields,
+	}
+
+	// Integers are decoded as int64.
+	var decoded func(v interface{}) interface{}
+	decoded = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case int:
+			return int64(v)
+		case []interface{}:
+			list := make([]interface{}, len(v))
+			for i, el := range v {
+				list[i] = decoded(el)
+			}
+			return list
+		case map[string]interface{}:
+			m := make(map[string]interface{}, len(v))
+			for key, el := range v {
+				m[key] = decoded(el)
+			}
+			return m
+		}
+		return v
+	}
+	want := decoded(v)
+
+	encoders := map[string]func(*bytes.Buffer, interface{}){
+		"testMsgpack":   testMsgpack,
+		"msgpackEncode": msgpackEncode,
+	}
+	for name, encode := range encoders {
+		buf := new(bytes.Buffer)
+		encode(buf, v)
+		got := (&msgpackDecoder{buf: buf.Bytes()}).decode()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Decoding the output of %s should give\n%#v\nbut "+
+				"gave\n%#v", name, want, got)
+		}
+	}
+
+	wide := []struct {
+		v   interface{}
+		typ byte
+	}{
+		{1, 0xd3},
+		{v["long"], 0xdb},
+		{many, 0xdd},
+		{fields, 0xdf},
+	}
+	for _, test := range wide {
+		buf := new(bytes.Buffer)
+		testMsgpack(buf, test.v)
+		if typ := buf.Bytes()[0]; typ != test.typ {
+			t.Fatalf("testMsgpack should write 0x%02x for %#v, but wrote "+
+				"0x%02x.", test.typ, test.v, typ)
+		}
+	}
+}
+
+// testEncodings returns the kinds of the encodings of each column of a
+// category in BinaryCIF data.
+func testEncodings(data []byte, cat string) map[string]string {
+	file := (&msgpackDecoder{buf: data}).decode().(map[string]interface{})
+	block := file["dataBlocks"].([]interface{})[0].(map[string]interface{})
+	kinds := make(map[string]string)
+	for _, c := range block["categories"].([]interface{}) {
+		c := c.(map[string]interface{})
+		if c["name"] != cat {
+			continue
+		}
+		for _, col := range c["columns"].([]interface{}) {
+			col := col.(map[string]interface{})
+			var names []string
+			encoded := col["data"].(map[string]interface{})
+			for _, enc := range encoded["encoding"].([]interface{}) {
+				names = append(names,
+					enc.(map[string]interface{})["kind"].(string))
+			}
+			kinds[col["name"].(string)] = strings.Join(names, " ")
+		}
+	}
+	return kinds
+}
+
+func TestWriteBinary(t *testing.T) {
+	data := `data_1ABC
+_entry.id 1ABC
+_cell.length_a 10.500
+_cell.z 4
+_cell.details ?
+loop_
+_atom_site.id
+_atom_site.label_comp_id
+_atom_site.Cartn_x
+_atom_site.B_iso_or_equiv
+_atom_site.label_seq_id
+_atom_site.pdbx_PDB_ins_code
+`
+	for i := 1; i <= 40; i++ {
+		data += sf("%d %s %.3f 0.%d123456789123 %d %s\n", i,
+			[]string{"ALA", "GLY", "SER"}[i%3], float64(i*i)/8-40,
+			i, 1+(i-1)/4, []string{".", "?", ".", "A"}[i%4])
+	}
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := cif.WriteBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.Bytes()
+
+	again := new(bytes.Buffer)
+	if err := cif.WriteBinary(again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, again.Bytes()) {
+		t.Fatalf("Writing the same CIF twice should produce the same output.")
+	}
+
+	read, err := ReadBinary(bytes.NewReader(written))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, rb := cif.Blocks["1abc"], read.Blocks["1abc"]
+	if rb == nil {
+		t.Fatalf("The data block '1abc' should be read back.")
+	}
+	for tag, v := range b.Items {
+		if rv := rb.Items[tag]; rv == nil || rv.Raw() != v.Raw() ||
+			Text(rv) != Text(v) {
+
+			t.Fatalf("The data item '%s' should be %#v but is %#v.",
+				tag, v, rv)
+		}
+	}
+	lp := b.Loops["atom_site.id"]
+	for tag := range lp.Columns {
+		if rb.Loops[tag] != rb.Loops["atom_site.id"] {
+			t.Fatalf("The data tag '%s' should be in the table.", tag)
+		}
+		want, got := lp.Get(tag), rb.Loops[tag].Get(tag)
+		if !reflect.DeepEqual(want.Raw(), got.Raw()) ||
+			!reflect.DeepEqual(Texts(want), Texts(got)) {
+
+			t.Fatalf("The values of '%s' should be\n%v\n%v\nbut are\n%v\n%v",
+				tag, want.Raw(), Texts(want), got.Raw(), Texts(got))
+		}
+	}
+
+	kinds := testEncodings(written, "_atom_site")
+	want := map[string]string{
+		"id":                "Delta RunLength ByteArray",
+		"label_comp_id":     "StringArray",
+		"Cartn_x":           "FixedPoint Delta ByteArray",
+		"B_iso_or_equiv":    "ByteArray",
+		"label_seq_id":      "RunLength ByteArray",
+		"pdbx_PDB_ins_code": "StringArray",
+	}
+	for name, kind := range want {
+		if kinds[strings.ToLower(name)] != kind {
+			t.Fatalf("The column '%s' should be encoded with %s, but is "+
+				"encoded with %s.", name, kind, kinds[strings.ToLower(name)])
+		}
+	}
+
+	// Floating point numbers are quantized when asked.
+	buf.Reset()
+	err = cif.WriteBinaryWith(buf, BinaryOptions{Steps: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.Bytes()) >= len(written) {
+		t.Fatalf("Quantized BinaryCIF should be smaller.")
+	}
+	kind := testEncodings(buf.Bytes(), "_atom_site")["b_iso_or_equiv"]
+	if !strings.HasPrefix(kind, "IntervalQuantization ") {
+		t.Fatalf("The column 'B_iso_or_equiv' should be quantized, but is "+
+			"encoded with %s.", kind)
+	}
+	read, err = ReadBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := lp.Get("atom_site.b_iso_or_equiv").Floats()
+	got := read.Blocks["1abc"].Loops["atom_site.id"].
+		Get("atom_site.b_iso_or_equiv").Floats()
+	for i := range orig {
+		if d := orig[i] - got[i]; d > 0.001 || d < -0.001 {
+			t.Fatalf("The quantized value %f should be close to %f.",
+				got[i], orig[i])
+		}
+	}
+}
+
+func TestWriteBinaryErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		kind WriteErrorKind
+	}{
+		{"data_a\nsave_f\n_x.y 1\nsave_\n", WriteInvalidStructure},
+		{"data_a\n_x.a 1\nloop_\n_x.b\n1\n2\n", WriteInvalidStructure},
+		{"data_a\n_x.a 4294967296\n", WriteInvalidValue},
+	}
+	for _, test := range tests {
+		cif, err := Read(strings.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cif.WriteBinary(new(bytes.Buffer))
+		if we, ok := err.(*WriteError); !ok || we.Kind != test.kind {
+			t.Fatalf("Writing\n%s\nshould fail with a %s, but got %v.",
+				test.data, test.kind, err)
+		}
+	}
+}
@@ -0,0 +1,584 @@
+package cif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+)
+
+// bcifVersion is the version of the BinaryCIF format written.
+const bcifVersion = "0.3.0"
+
+// bcifMaxDigits is the largest number of decimal places of a floating point
+// column written with the FixedPoint encoding.
+const bcifMaxDigits = 9
+
+// BinaryOptions controls the output of WriteBinaryWith. The zero value of
+// BinaryOptions corresponds to the output of WriteBinary.
+type BinaryOptions struct {
+	// Steps, when greater than 1, is the number of steps used to store
+	// floating point columns that cannot be stored exactly with the
+	// FixedPoint encoding. Such columns are stored with the
+	// IntervalQuantization encoding, where every value is rounded to the
+	// nearest of Steps evenly spaced values between the smallest and largest
+	// values of the column. This loses precision, but is much smaller than
+	// storing each value with 8 bytes (which is done otherwise).
+	Steps int
+}
+
+type binaryWriter struct {
+	*writer
+	opts BinaryOptions
+}
+
+// WriteBinary writes an existing CIF to the writer given as BinaryCIF, which
+// may be read with ReadBinary. Data blocks and data items are written in the
+// same order as Write writes them, and the output is deterministic.
+//
+// Each column of values is compressed with the encodings that make it
+// smallest:
+//
+// Integers are stored in the smallest type they fit in (possibly with the
+// IntegerPacking encoding), after the Delta encoding, the RunLength encoding
+// or both, whichever is smallest. e.g., sequential IDs are stored as
+// differences (with Delta), which are stored as runs of the same difference
+// (with RunLength).
+//
+// Floating point numbers with at most 9 decimal places (like coordinates)
+// are stored as integers with the FixedPoint encoding, which keeps the
+// number of decimal places of their text. Other floating point numbers are
+// stored with 4 bytes if they are exactly representable with 4 bytes, and 8
+// bytes otherwise (but see BinaryOptions).
+//
+// Strings are stored with the StringArray encoding, where each distinct
+// string is stored once (which suits the residue names of a structure).
+//
+// Omitted (".") and missing ("?") values are stored in the mask of each
+// column. The standard uncertainties of numbers are not stored.
+//
+// BinaryCIF stores each category of a data block as a table, so every data
+// item of a category must be in the same table (or not in any table), and
+// save frames and CIF 2.0 lists and tables cannot be written. Data tags
+// without a '.' (as in DDL1 dictionaries) are each written as a category of
+// their own, so a table of such data tags is read back as separate tables.
+//
+// Before anything is written, the CIF is checked with Validate. If there are
+// any problems, then nothing is written and the problems are returned as
+// ValidationErrors. Otherwise, any error returned has type *WriteError.
+func (cif *CIF) WriteBinary(w io.Writer) error {
+	return cif.WriteBinaryWith(w, BinaryOptions{})
+}
+
+// WriteBinaryWith is like WriteBinary, except the output is controlled by the
+// options given.
+func (cif *CIF) WriteBinaryWith(w io.Writer, opts BinaryOptions) error {
+	if err := cif.Validate(); err != nil {
+		return err
+	}
+	return (&binaryWriter{
+		writer: &writer{CIF: cif, w: w},
+		opts:   opts,
+	}).write()
+}
+
+func (w *binaryWriter) write() (err error) {
+	defer w.recover(&err)
+	names := make([]string, 0, len(w.Blocks))
+	for name := range w.Blocks {
+		names = append(names, name)
+	}
+	blocks := make([]interface{}, 0, len(names))
+	for _, name := range ordered(w.order, names, lessString) {
+		b := w.Blocks[name]
+		w.block, w.frame, w.tag = b.Name, "", ""
+		if len(b.Frames) > 0 {
+			w.errf(WriteInvalidStructure,
+				"Save frames cannot be written as BinaryCIF.")
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"header":     b.Name,
+			"categories": w.categories(&b.Block),
+		})
+	}
+
+	buf := new(bytes.Buffer)
+	msgpackEncode(buf, map[string]interface{}{
+		"version":    bcifVersion,
+		"encoder":    "github.com/BurntSushi/cif",
+		"dataBlocks": blocks,
+	})
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		w.fail(WriteIO, err, "%s", err)
+	}
+	return nil
+}
+
+// bcifGroup is the data tags of a category in a block, which are either
+// in the same table or not in any table (when loop is nil).
+type bcifGroup struct {
+	name string
+	loop *Loop
+	tags []string
+}
+
+// categories returns the categories of a block.
+func (w *binaryWriter) categories(b *Block) []interface{} {
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+
+	var groups []*bcifGroup
+	byName := make(map[string]*bcifGroup, 10)
+	for _, tag := range ordered(b.order, tags, lessTag) {
+		w.tag = tag
+		name, lp := tagCategory(tag), b.Loops[tag]
+		g := byName[name]
+		if g == nil {
+			g = &bcifGroup{name: name, loop: lp}
+			byName[name] = g
+			groups = append(groups, g)
+		} else if g.loop != lp {
+			w.errf(WriteInvalidStructure, "The data items of the category "+
+				"'%s' are not all in the same table, which BinaryCIF "+
+				"cannot represent.", name)
+		}
+		g.tags = append(g.tags, tag)
+	}
+
+	cats := make([]interface{}, len(groups))
+	for i, g := range groups {
+		rows := 1
+		if g.loop != nil {
+			rows = len(columnTexts(g.loop.Get(g.tags[0])))
+		}
+		cols := make([]interface{}, len(g.tags))
+		for j, tag := range g.tags {
+			w.tag = tag
+			var vals ValueLoop
+			if g.loop != nil {
+				vals = g.loop.Get(tag)
+			} else {
+				vals = w.itemColumn(b.Items[tag])
+			}
+			cols[j] = w.column(strings.TrimPrefix(tag[len(g.name):], "."),
+				vals)
+		}
+		cats[i] = map[string]interface{}{
+			"name":     "_" + g.name,
+			"rowCount": rows,
+			"columns":  cols,
+		}
+	}
+	w.tag = ""
+	return cats
+}
+
+// itemColumn returns the value of a data item that is not in a table as a
+// column with one value.
+func (w *binaryWriter) itemColumn(v Value) ValueLoop {
+	text := []string{Text(v)}
+	switch raw := v.Raw().(type) {
+	case int:
+		return cifInts{ints: []int{raw}, texts: text}
+	case float64:
+		return cifFloats{floats: []float64{raw}, texts: text}
+	case string:
+		return cifStrings(text)
+	}
+	w.errf(WriteUnsupportedType, "Values with type '%T' cannot be written "+
+		"as BinaryCIF.", v.Raw())
+	panic("unreachable")
+}
+
+// column returns an encoded column of values with the name given.
+func (w *binaryWriter) column(name string, vals ValueLoop) interface{} {
+	texts := columnTexts(vals)
+	var mask []int
+	for i, s := range texts {
+		if !isNullText(s) {
+			continue
+		}
+		if mask == nil {
+			mask = make([]int, len(texts))
+		}
+		mask[i] = bcifOmitted
+		if s == "?" {
+			mask[i] = bcifMissing
+		}
+	}
+
+	var data map[string]interface{}
+	switch raw := vals.Raw().(type) {
+	case []int:
+		ints := make([]int, len(raw))
+		for i, n := range raw {
+			if mask == nil || mask[i] == bcifPresent {
+				ints[i] = n
+			}
+		}
+		data = w.encodeInts(ints)
+	case []float64:
+		floats := make([]float64, len(raw))
+		for i, f := range raw {
+			if mask == nil || mask[i] == bcifPresent {
+				floats[i] = f
+			}
+		}
+		data = w.encodeFloats(floats, texts, mask)
+	case []string:
+		data = w.encodeStrings(raw, mask)
+	default:
+		w.errf(WriteUnsupportedType, "Columns with type '%T' cannot be "+
+			"written as BinaryCIF.", raw)
+	}
+
+	col := map[string]interface{}{"name": name, "data": data, "mask": nil}
+	if mask != nil {
+		col["mask"] = w.encodeInts(mask)
+	}
+	return col
+}
+
+// encodeStrings returns strings encoded with the StringArray encoding.
+// Strings masked as omitted or missing are not stored.
+func (w *binaryWriter) encodeStrings(
+	strs []string,
+	mask []int,
+) map[string]interface{} {
+	index := make(map[string]int, 10)
+	indices := make([]int, len(strs))
+	offsets := []int{0}
+	var all bytes.Buffer
+	for i, s := range strs {
+		if mask != nil && mask[i] != bcifPresent {
+			indices[i] = -1
+			continue
+		}
+		j, ok := index[s]
+		if !ok {
+			j = len(index)
+			index[s] = j
+			all.WriteString(s)
+			offsets = append(offsets, all.Len())
+		}
+		indices[i] = j
+	}
+
+	data, offsetData := w.encodeInts(indices), w.encodeInts(offsets)
+	return map[string]interface{}{
+		"encoding": []interface{}{map[string]interface{}{
+			"kind":           "StringArray",
+			"dataEncoding":   data["encoding"],
+			"stringData":     all.String(),
+			"offsetEncoding": offsetData["encoding"],
+			"offsets":        offsetData["data"],
+		}},
+		"data": data["data"],
+	}
+}
+
+// encodeFloats returns floating point numbers (along with their texts)
+// encoded with the FixedPoint encoding if they can be stored exactly with
+// it, and otherwise with the IntervalQuantization encoding (if enabled) or
+// the ByteArray encoding.
+func (w *binaryWriter) encodeFloats(
+	floats []float64,
+	texts []string,
+	mask []int,
+) map[string]interface{} {
+	// Start with the number of decimal places in the texts, so that they
+	// are kept, then find the fewest that store every number exactly.
+	digits := 0
+	for i, s := range texts {
+		if mask != nil && mask[i] != bcifPresent {
+			continue
+		}
+		s = trimUncertainty(s)
+		if j := strings.IndexByte(s, '.'); j > -1 &&
+			!strings.ContainsAny(s, "eE") && len(s)-j-1 > digits {
+
+			digits = len(s) - j - 1
+		}
+	}
+	for ; digits <= bcifMaxDigits; digits++ {
+		if ints, ok := bcifFixed(floats, math.Pow10(digits)); ok {
+			return w.encodeEncoded(map[string]interface{}{
+				"kind":    "FixedPoint",
+				"factor":  math.Pow10(digits),
+				"srcType": bcifFloat64,
+			}, ints)
+		}
+	}
+
+	if w.opts.Steps > 1 {
+		min, max := math.Inf(1), math.Inf(-1)
+		for i, f := range floats {
+			if mask == nil || mask[i] == bcifPresent {
+				min, max = math.Min(min, f), math.Max(max, f)
+			}
+		}
+		if !math.IsInf(min, 0) && !math.IsInf(max, 0) {
+			ints := make([]int, len(floats))
+			if max > min {
+				delta := (max - min) / float64(w.opts.Steps-1)
+				for i, f := range floats {
+					if mask == nil || mask[i] == bcifPresent {
+						ints[i] = int(math.Round((f - min) / delta))
+					}
+				}
+			}
+			return w.encodeEncoded(map[string]interface{}{
+				"kind":     "IntervalQuantization",
+				"min":      min,
+				"max":      max,
+				"numSteps": w.opts.Steps,
+				"srcType":  bcifFloat64,
+			}, ints)
+		}
+	}
+
+	typ := bcifFloat32
+	for _, f := range floats {
+		if float64(float32(f)) != f && !math.IsNaN(f) {
+			typ = bcifFloat64
+			break
+		}
+	}
+	return map[string]interface{}{
+		"encoding": []interface{}{map[string]interface{}{
+			"kind": "ByteArray", "type": typ,
+		}},
+		"data": bcifByteData(typ, floats),
+	}
+}
+
+// bcifFixed returns floating point numbers multiplied by a factor as
+// integers, if every number can be read back exactly from its integer.
+func bcifFixed(floats []float64, factor float64) ([]int, bool) {
+	ints := make([]int, len(floats))
+	for i, f := range floats {
+		n := math.Round(f * factor)
+		if n < math.MinInt32 || n > math.MaxInt32 || n/factor != f {
+			return nil, false
+		}
+		ints[i] = int(n)
+	}
+	return ints, true
+}
+
+// encodeEncoded returns integers encoded with encodeInts, after an encoding
+// that produced them.
+func (w *binaryWriter) encodeEncoded(
+	enc map[string]interface{},
+	ints []int,
+) map[string]interface{} {
+	data := w.encodeInts(ints)
+	data["encoding"] = append([]interface{}{enc},
+		data["encoding"].([]interface{})...)
+	return data
+}
+
+// encodeInts returns integers encoded with the smallest combination of the
+// Delta and RunLength encodings (including neither), followed by the
+// IntegerPacking encoding (if it is smaller) and the ByteArray encoding.
+func (w *binaryWriter) encodeInts(ints []int) map[string]interface{} {
+	for _, n := range ints {
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			w.errf(WriteInvalidValue, "The integer %d does not fit in 32 "+
+				"bits, which BinaryCIF requires.", n)
+		}
+	}
+	encs, data, _ := bcifPack(nil, ints)
+	for _, delta := range []bool{false, true} {
+		for _, runs := range []bool{false, true} {
+			if !delta && !runs {
+				continue
+			}
+			var prefix []interface{}
+			vals := ints
+			if delta {
+				prefix = append(prefix, map[string]interface{}{
+					"kind":    "Delta",
+					"origin":  bcifOrigin(vals),
+					"srcType": bcifInt32,
+				})
+				vals = bcifDelta(vals)
+			}
+			if runs {
+				prefix = append(prefix, map[string]interface{}{
+					"kind":    "RunLength",
+					"srcType": bcifInt32,
+					"srcSize": len(vals),
+				})
+				vals = bcifRunLength(vals)
+			}
+			e, d, ok := bcifPack(prefix, vals)
+			if ok && len(d) < len(data) {
+				encs, data = e, d
+			}
+		}
+	}
+	return map[string]interface{}{"encoding": encs, "data": data}
+}
+
+// bcifOrigin returns the origin of the Delta encoding of integers.
+func bcifOrigin(ints []int) int {
+	if len(ints) == 0 {
+		return 0
+	}
+	return ints[0]
+}
+
+// bcifDelta returns the differences between consecutive integers, starting
+// with the difference between the first integer and itself (the origin).
+func bcifDelta(ints []int) []int {
+	deltas := make([]int, len(ints))
+	for i := 1; i < len(ints); i++ {
+		deltas[i] = ints[i] - ints[i-1]
+	}
+	return deltas
+}
+
+// bcifRunLength returns pairs of an integer and the number of times it is
+// repeated.
+func bcifRunLength(ints []int) []int {
+	var runs []int
+	for i := 0; i < len(ints); {
+		j := i + 1
+		for j < len(ints) && ints[j] == ints[i] {
+			j++
+		}
+		runs = append(runs, ints[i], j-i)
+		i = j
+	}
+	return runs
+}
+
+// bcifPack returns integers encoded with the ByteArray encoding using the
+// smallest type they fit in, after the IntegerPacking encoding if that is
+// smaller. The encodings returned follow the ones given. If the integers
+// don't fit in 32 bits, then false is returned.
+func bcifPack(
+	encs []interface{},
+	ints []int,
+) ([]interface{}, []byte, bool) {
+	min, max := 0, 0
+	for _, n := range ints {
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	typ, size := bcifIntType(min, max)
+	if typ == 0 {
+		return nil, nil, false
+	}
+	packing, vals := 0, ints
+	for _, byteCount := range []int{1, 2} {
+		if byteCount >= size {
+			break
+		}
+		packed, upper, lower := bcifIntPack(ints, byteCount, min >= 0)
+		if len(packed)*byteCount < len(vals)*size {
+			packing, vals = byteCount, packed
+			typ, size = bcifIntType(lower, upper)
+		}
+	}
+
+	all := make([]interface{}, len(encs), len(encs)+2)
+	copy(all, encs)
+	if packing > 0 {
+		all = append(all, map[string]interface{}{
+			"kind":       "IntegerPacking",
+			"byteCount":  packing,
+			"isUnsigned": min >= 0,
+			"srcSize":    len(ints),
+		})
+	}
+	all = append(all, map[string]interface{}{"kind": "ByteArray", "type": typ})
+	return all, bcifByteData(typ, vals), true
+}
+
+// bcifIntPack returns integers encoded with the IntegerPacking encoding,
+// where integers that don't fit in byteCount bytes are written as sums of
+// the limits of integers that do. The limits are also returned.
+func bcifIntPack(ints []int, byteCount int, unsigned bool) ([]int, int, int) {
+	upper, lower := math.MaxInt8, math.MinInt8
+	switch {
+	case byteCount == 1 && unsigned:
+		upper, lower = math.MaxUint8, 0
+	case byteCount == 2 && unsigned:
+		upper, lower = math.MaxUint16, 0
+	case byteCount == 2:
+		upper, lower = math.MaxInt16, math.MinInt16
+	}
+	packed := make([]int, 0, len(ints))
+	for _, n := range ints {
+		for n >= upper {
+			packed = append(packed, upper)
+			n -= upper
+		}
+		for lower < 0 && n <= lower {
+			packed = append(packed, lower)
+			n -= lower
+		}
+		packed = append(packed, n)
+	}
+	return packed, upper, lower
+}
+
+// bcifIntType returns the ByteArray type (and its size) of the smallest
+// integers that fit every integer between min and max. If no type fits,
+// then the type returned is 0.
+func bcifIntType(min, max int) (int, int) {
+	switch {
+	case min >= 0 && max <= math.MaxUint8:
+		return bcifUint8, 1
+	case min >= math.MinInt8 && max <= math.MaxInt8:
+		return bcifInt8, 1
+	case min >= 0 && max <= math.MaxUint16:
+		return bcifUint16, 2
+	case min >= math.MinInt16 && max <= math.MaxInt16:
+		return bcifInt16, 2
+	case min >= math.MinInt32 && max <= math.MaxInt32:
+		return bcifInt32, 4
+	}
+	return 0, 0
+}
+
+// bcifBytes returns numbers ([]int or []float64) as the data of the
+// ByteArray encoding with the type given, in little-endian order.
+func bcifByteData(typ int, nums interface{}) []byte {
+	buf := new(bytes.Buffer)
+	le := binary.LittleEndian
+	switch nums := nums.(type) {
+	case []int:
+		for _, n := range nums {
+			switch typ {
+			case bcifInt8, bcifUint8:
+				buf.WriteByte(byte(n))
+			case bcifInt16, bcifUint16:
+				binary.Write(buf, le, uint16(n))
+			default:
+				binary.Write(buf, le, uint32(n))
+			}
+		}
+	case []float64:
+		for _, f := range nums {
+			if typ == bcifFloat32 {
+				binary.Write(buf, le, math.Float32bits(float32(f)))
+			} else {
+				binary.Write(buf, le, math.Float64bits(f))
+			}
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func describe(args []string) {
+	flags := newFlags("describe", "dictionary tag ...")
+	ddl := flags.String("ddl", "",
+		"The language of the dictionary: ddl1, ddl2 or ddlm. "+
+			"(Detected when omitted.)")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+	}
+
+	d, err := loadDictionary(flags.Arg(0), *ddl)
+	if err != nil {
+		log.Fatalf("Could not load dictionary '%s': %s", flags.Arg(0), err)
+	}
+	for i, tag := range flags.Args()[1:] {
+		doc, err := d.Describe(tag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(doc)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/cif"
+)
+
+func gen(args []string) {
+	flags := newFlags("gen", "dictionary")
+	pkg := flags.String("package", os.Getenv("GOPACKAGE"),
+		"The package name of the Go source code. (Defaults to the package "+
+			"running 'go generate'.)")
+	output := flags.String("o", "",
+		"The file to write to. (Defaults to stdout.)")
+	categories := flags.String("categories", "",
+		"A comma-separated list of categories to write types for. "+
+			"(Defaults to all.)")
+	pointers := flags.Bool("pointers", false,
+		"Make every field a pointer, so that null values are nil when "+
+			"read with Block.Unmarshal.")
+	ddl := flags.String("ddl", "",
+		"The language of the dictionary: ddl1, ddl2 or ddlm. "+
+			"(Detected when omitted.)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+	}
+	if len(*pkg) == 0 {
+		log.Fatalf("The package name must be given with -package.")
+	}
+
+	d, err := loadDictionary(flags.Arg(0), *ddl)
+	if err != nil {
+		log.Fatalf("Could not load dictionary '%s': %s", flags.Arg(0), err)
+	}
+	opts := cif.GoOptions{Package: *pkg, Pointers: *pointers}
+	if len(*categories) > 0 {
+		opts.Categories = strings.Split(*categories, ",")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := d.WriteGo(buf, opts); err != nil {
+		log.Fatal(err)
+	}
+	if len(*output) == 0 {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/BurntSushi/cif"
+)
+
+func infer(args []string) {
+	flags := newFlags("infer", "file ...")
+	title := flags.String("title", "draft.dic",
+		"The title of the dictionary.")
+	output := flags.String("o", "",
+		"The file to write to. (Defaults to stdout.)")
+	maxEnum := flags.Int("enum", 10,
+		"The largest number of distinct values of an enumeration.")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+	}
+
+	inf := cif.NewInferrer()
+	inf.MaxEnumeration = *maxEnum
+	for _, fpath := range flags.Args() {
+		c, err := readFile(fpath)
+		if err != nil {
+			log.Fatalf("Could not read '%s': %s", fpath, err)
+		}
+		inf.Add(c)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := inf.Dictionary(*title).DDL2().Write(buf); err != nil {
+		log.Fatal(err)
+	}
+	if len(*output) == 0 {
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+// Command cif works with CIF dictionaries.
+//
+// Usage:
+//
+//	cif gen [flags] dictionary
+//	cif describe [flags] dictionary tag ...
+//	cif infer [flags] file ...
+//
+// The gen command writes Go source code declaring a struct type for each
+// category of a dictionary (see Dictionary.WriteGo). It is suitable for use
+// with "go generate", e.g.:
+//
+//	//go:generate cif gen -o pdbx.go mmcif_pdbx.dic
+//
+// Values of the types are read from a data block with Block.Unmarshal.
+//
+// The describe command prints the documentation of data items in a
+// dictionary (see Dictionary.Describe): their descriptions, types, units,
+// permitted values, categories and links. e.g.:
+//
+//	cif describe mmcif_pdbx.dic _refine.ls_R_factor_R_free
+//
+// The infer command writes a draft DDL2 dictionary describing the data items
+// found in CIF files (see Inferrer.Dictionary): whether they appear in
+// tables, the types of their values, their enumerations and their ranges.
+// The draft should be reviewed and completed by hand.
+//
+// Dictionaries may be written in DDL1 (like cif_core.dic), DDL2 (like
+// mmcif_pdbx.dic) or DDLm (like version 3 of cif_core.dic). The language is
+// detected automatically unless it is given with the -ddl flag.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/cif"
+)
+
+// commands maps the name of each command to the function that runs it with
+// the remaining command line arguments.
+var commands = map[string]func(args []string){
+	"gen":      gen,
+	"describe": describe,
+	"infer":    infer,
+}
+
+func init() {
+	log.SetFlags(0)
+	flag.Usage = usage
+}
+
+func usage() {
+	log.Printf("Usage: %s command [flags] arguments\n\n"+
+		"The commands are:\n\n"+
+		"\tgen         write Go types for the categories of a dictionary\n"+
+		"\tdescribe    print the documentation of data items\n"+
+		"\tinfer       write a draft dictionary for the data in CIF files\n\n"+
+		"Run '%s command -h' for the flags of a command.",
+		path.Base(os.Args[0]), path.Base(os.Args[0]))
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+	}
+	run := commands[flag.Arg(0)]
+	if run == nil {
+		log.Printf("Unknown command '%s'.\n", flag.Arg(0))
+		flag.Usage()
+	}
+	run(flag.Args()[1:])
+}
+
+// newFlags returns the flags of a command, with a usage message describing
+// its arguments.
+func newFlags(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		log.Printf("Usage: %s %s [flags] %s\n",
+			path.Base(os.Args[0]), name, args)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	return flags
+}
+
+// loadDictionary reads the dictionary in the file given. The language of the
+// dictionary is one of "ddl1", "ddl2" or "ddlm", or it is detected when ddl
+// is empty. Files imported by a DDLm dictionary are read from the directory
+// containing it.
+func loadDictionary(fpath, ddl string) (*cif.Dictionary, error) {
+	c, err := readFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if len(ddl) == 0 {
+		ddl = detectDDL(c)
+	}
+	switch strings.ToLower(ddl) {
+	case "ddl1":
+		return cif.LoadDDL1(c)
+	case "ddl2":
+		return cif.LoadDDL2(c)
+	case "ddlm":
+		return cif.LoadDDLm(c, filepath.Dir(fpath))
+	}
+	return nil, fmt.Errorf("Unknown dictionary language '%s'.", ddl)
+}
+
+// readFile reads the CIF file given.
+func readFile(fpath string) (*cif.CIF, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return cif.Read(f)
+}
+
+// detectDDL returns the language of a dictionary. DDL2 and DDLm dictionaries
+// define their data items in save frames (with "_item.name" and
+// "_definition.id", respectively), while DDL1 dictionaries do not use save
+// frames.
+func detectDDL(c *cif.CIF) string {
+	for _, b := range c.Blocks {
+		for _, frame := range b.Frames {
+			if _, ok := frame.Items["definition.id"]; ok {
+				return "ddlm"
+			}
+		}
+		if len(b.Frames) > 0 {
+			return "ddl2"
+		}
+	}
+	return "ddl1"
+}
@@ -0,0 +1,560 @@
+package cif
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dictionary represents the schema information in a CIF dictionary. It
+// describes the categories and data items that may appear in CIF data, along
+// with the types of their values.
+//
+// All category names, data tags and type codes in a Dictionary are stored in
+// lowercase and without a leading underscore (just like data tags in a
+// Block). The methods Category, Item and Type may be used to look them up
+// without regard to case or a leading underscore.
+type Dictionary struct {
+	// Title and Version identify the dictionary. e.g., "mmcif_pdbx.dic" and
+	// "5.0".
+	Title, Version string
+
+	// Categories maps category names to their definitions.
+	Categories map[string]*CategoryDef
+
+	// Items maps data tags to their definitions.
+	Items map[string]*ItemDef
+
+	// Types maps type codes to their definitions.
+	Types map[string]*TypeDef
+
+	// Units maps unit codes to their descriptions.
+	Units map[string]string
+
+	// Links contains every parent/child relationship between data items.
+	Links []Link
+
+	// aliases maps the aliases of data items to their data tags. It is
+	// built when the dictionary is loaded. (See Canonical.)
+	aliases map[string]string
+}
+
+// CategoryDef is the definition of a category of data items.
+type CategoryDef struct {
+	// Name is the name of the category. e.g., "atom_site".
+	Name string
+
+	// Description describes the category in prose.
+	Description string
+
+	// Mandatory is true when the category must appear in every data block.
+	Mandatory bool
+
+	// Keys contains the data tags whose values together uniquely identify
+	// each row of the category.
+	Keys []string
+
+	// Groups contains the names of the category groups that the category
+	// belongs to.
+	Groups []string
+
+	// Items contains the data tags of every data item in the category, in
+	// sorted order.
+	Items []string
+
+	// Parent is the name of the category that this category belongs to, if
+	// any. Only DDLm dictionaries arrange categories in a hierarchy.
+	Parent string
+
+	// Class is the DDLm class of the category: "Head" (the root of the
+	// hierarchy), "Set" (its data items appear at most once per data block)
+	// or "Loop" (its data items may appear in a table). It is empty for
+	// other dictionaries.
+	Class string
+}
+
+// ItemDef is the definition of a single data item.
+type ItemDef struct {
+	// Name is the data tag of the data item. e.g., "atom_site.cartn_x".
+	Name string
+
+	// Category is the name of the category that the data item belongs to.
+	Category string
+
+	// Description describes the data item in prose.
+	Description string
+
+	// Mandatory is true when the data item must appear whenever its
+	// category appears.
+	Mandatory bool
+
+	// Type is the code of the type of the data item's values. It is a key
+	// in the Types of the dictionary.
+	Type string
+
+	// Units is the code of the units of the data item's values, if any.
+	Units string
+
+	// Default is the value of the data item when it is omitted, if any.
+	Default string
+
+	// Enumeration contains the only values permitted for the data item. If
+	// it is empty, then any value of the right type is permitted.
+	Enumeration []string
+
+	// Ranges contains the ranges of numeric values permitted for the data
+	// item. A value is permitted if it is in any of the ranges. If there are
+	// no ranges, then any value of the right type is permitted.
+	Ranges []Range
+
+	// List is the looping rule of the data item: "yes" if it must appear in
+	// a table, "no" if it must not, or "both" (or empty) if either is
+	// permitted. Only DDL1 dictionaries define looping rules.
+	List string
+
+	// Container, Contents and Purpose describe the values of the data item
+	// in a DDLm dictionary. Container is the structure of each value (e.g.,
+	// "Single", "List" or "Table"), Contents is the type of its elements
+	// (e.g., "Real" or "Code") and Purpose is the role of the data item
+	// (e.g., "Measurand" or "Key"). Each is empty for other dictionaries.
+	Container, Contents, Purpose string
+
+	// Aliases contains other data tags that name the same data item, such as
+	// the names used by older versions of the dictionary. e.g.,
+	// "symmetry_space_group_name_h-m" for "space_group.name_h-m_alt".
+	Aliases []string
+}
+
+// TypeDef is the definition of a type of value.
+type TypeDef struct {
+	// Code is the name of the type. e.g., "float".
+	Code string
+
+	// Primitive is the primitive type of the type. It is one of "numb",
+	// "char", "uchar" (for case-insensitive strings) or "null".
+	Primitive string
+
+	// Construct is the regular expression, as written in the dictionary,
+	// that every value of the type must match.
+	Construct string
+
+	// Detail describes the type in prose.
+	Detail string
+
+	// Regexp is Construct compiled such that it must match an entire value.
+	// It is nil if Construct is empty or is not a valid regular expression.
+	Regexp *regexp.Regexp
+}
+
+// Match returns true if the given value (as written in CIF data) is a valid
+// value of this type. If the type has no regular expression, then every value
+// is valid.
+func (td *TypeDef) Match(s string) bool {
+	return td.Regexp == nil || td.Regexp.MatchString(s)
+}
+
+// Range is a range of numeric values.
+type Range struct {
+	// Min and Max are the bounds of the range. Min is only meaningful when
+	// HasMin is true, and Max is only meaningful when HasMax is true.
+	Min, Max       float64
+	HasMin, HasMax bool
+
+	// Exclusive is true when values equal to a bound are not in the range.
+	// (Unless both bounds are equal, in which case the range contains
+	// exactly one value.)
+	Exclusive bool
+}
+
+// Contains returns true if f is in the range.
+func (r Range) Contains(f float64) bool {
+	if r.HasMin && r.HasMax && r.Min == r.Max {
+		return f == r.Min
+	}
+	if r.Exclusive {
+		return (!r.HasMin || f > r.Min) && (!r.HasMax || f < r.Max)
+	}
+	return (!r.HasMin || f >= r.Min) && (!r.HasMax || f <= r.Max)
+}
+
+// String returns the range in the notation used by DDL1 dictionaries, with
+// '.' standing in for a missing bound. e.g., "0.0:." or "1:10".
+func (r Range) String() string {
+	bound := func(has bool, f float64) string {
+		if !has {
+			return "."
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return bound(r.HasMin, r.Min) + ":" + bound(r.HasMax, r.Max)
+}
+
+// Link is a relationship between a child data item and a parent data item.
+// Every value of the child must also be a value of the parent.
+type Link struct {
+	Child, Parent string
+
+	// Group, when not empty, identifies a set of links between the same two
+	// categories that must hold together. That is, the values of the
+	// children in each row must match the values of the parents in a single
+	// row of the parent category.
+	Group string
+}
+
+// dictName returns the name given without a leading underscore and in
+// lowercase, which is how names are stored in a Dictionary.
+func dictName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "_"))
+}
+
+// Category returns the definition of the category with the name given, or
+// nil if there is no such category.
+func (d *Dictionary) Category(name string) *CategoryDef {
+	return d.Categories[dictName(name)]
+}
+
+// Item returns the definition of the data item with the tag given, or nil if
+// there is no such data item.
+func (d *Dictionary) Item(tag string) *ItemDef {
+	return d.Items[dictName(tag)]
+}
+
+// Type returns the definition of the type of the data item with the tag
+// given, or nil if the data item or its type is not defined.
+func (d *Dictionary) Type(tag string) *TypeDef {
+	item := d.Item(tag)
+	if item == nil {
+		return nil
+	}
+	return d.Types[item.Type]
+}
+
+// Parents returns the data tags of the parents of the data item with the tag
+// given.
+func (d *Dictionary) Parents(tag string) []string {
+	tag = dictName(tag)
+	parents := make([]string, 0)
+	for _, link := range d.Links {
+		if link.Child == tag {
+			parents = append(parents, link.Parent)
+		}
+	}
+	return parents
+}
+
+// Children returns the data tags of the children of the data item with the
+// tag given.
+func (d *Dictionary) Children(tag string) []string {
+	tag = dictName(tag)
+	children := make([]string, 0)
+	for _, link := range d.Links {
+		if link.Parent == tag {
+			children = append(children, link.Child)
+		}
+	}
+	return children
+}
+
+// LoadDDL2 builds a Dictionary from a DDL2 dictionary (like mmcif_pdbx.dic)
+// that has been read with Read. The dictionary must be the first data block
+// in the CIF. Categories and data items are defined in its save frames, while
+// types, units and links may be defined in the data block itself. Aliases
+// come from "_item_aliases.alias_name".
+//
+// An error is returned if the CIF does not contain any definitions.
+func LoadDDL2(cif *CIF) (*Dictionary, error) {
+	block := firstBlock(cif)
+	if block == nil {
+		return nil, fmt.Errorf("The dictionary has no data blocks.")
+	}
+	d := &Dictionary{
+		Title:      dictValue(&block.Block, "dictionary.title"),
+		Version:    dictValue(&block.Block, "dictionary.version"),
+		Categories: make(map[string]*CategoryDef, 100),
+		Items:      make(map[string]*ItemDef, 1000),
+		Types:      make(map[string]*TypeDef, 50),
+		Units:      make(map[string]string, 50),
+	}
+	d.loadDDL2Block(&block.Block)
+	for _, frame := range orderedFrames(block) {
+		d.loadDDL2Category(&frame.Block)
+		d.loadDDL2Items(frame.Name, &frame.Block)
+		d.loadDDL2Block(&frame.Block)
+	}
+	if len(d.Categories) == 0 && len(d.Items) == 0 {
+		return nil, fmt.Errorf("The dictionary '%s' does not define any "+
+			"categories or data items.", block.Name)
+	}
+	d.finish()
+	return d, nil
+}
+
+// loadDDL2Block loads the definitions that may appear in the data block of a
+// DDL2 dictionary: types, units and links.
+func (d *Dictionary) loadDDL2Block(b *Block) {
+	codes := dictColumn(b, "item_type_list.code")
+	prims := dictColumn(b, "item_type_list.primitive_code")
+	constructs := dictColumn(b, "item_type_list.construct")
+	details := dictColumn(b, "item_type_list.detail")
+	for i := range codes {
+		code := valueAt(codes, i)
+		if len(code) == 0 {
+			continue
+		}
+		d.addType(&TypeDef{
+			Code:      dictName(code),
+			Primitive: strings.ToLower(valueAt(prims, i)),
+			Construct: strings.TrimSpace(valueAt(constructs, i)),
+			Detail:    strings.TrimSpace(valueAt(details, i)),
+		})
+	}
+
+	units := dictColumn(b, "item_units_list.code")
+	udetails := dictColumn(b, "item_units_list.detail")
+	for i := range units {
+		code := valueAt(units, i)
+		if len(code) == 0 {
+			continue
+		}
+		d.Units[strings.ToLower(code)] = strings.TrimSpace(valueAt(udetails, i))
+	}
+
+	children := dictColumn(b, "item_linked.child_name")
+	parents := dictColumn(b, "item_linked.parent_name")
+	for i := range children {
+		d.addLink(Link{
+			Child:  dictName(valueAt(children, i)),
+			Parent: dictName(valueAt(parents, i)),
+		})
+	}
+
+	children = dictColumn(b, "pdbx_item_linked_group_list.child_name")
+	parents = dictColumn(b, "pdbx_item_linked_group_list.parent_name")
+	cats := dictColumn(b, "pdbx_item_linked_group_list.child_category_id")
+	groups := dictColumn(b, "pdbx_item_linked_group_list.link_group_id")
+	for i := range children {
+		group := ""
+		if len(valueAt(groups, i)) > 0 {
+			group = dictName(valueAt(cats, i)) + ":" + valueAt(groups, i)
+		}
+		d.addLink(Link{
+			Child:  dictName(valueAt(children, i)),
+			Parent: dictName(valueAt(parents, i)),
+			Group:  group,
+		})
+	}
+}
+
+// loadDDL2Category loads the category defined in a save frame, if any.
+func (d *Dictionary) loadDDL2Category(b *Block) {
+	name := dictValue(b, "category.id")
+	if len(name) == 0 {
+		return
+	}
+	cat := &CategoryDef{
+		Name:        dictName(name),
+		Description: strings.TrimSpace(dictValue(b, "category.description")),
+		Mandatory:   isYes(dictValue(b, "category.mandatory_code")),
+		Groups:      dictValues(b, "category_group.id"),
+	}
+	for _, key := range dictValues(b, "category_key.name") {
+		cat.Keys = append(cat.Keys, dictName(key))
+	}
+	d.Categories[cat.Name] = cat
+}
+
+// loadDDL2Items loads the data items defined in a save frame, if any. A
+// single save frame may define several data items (typically a parent and
+// its children). Every definition in the save frame applies to all of them,
+// except that a data item's own save frame takes precedence over others.
+func (d *Dictionary) loadDDL2Items(frame string, b *Block) {
+	names := dictColumn(b, "item.name")
+	cats := dictColumn(b, "item.category_id")
+	mandatory := dictColumn(b, "item.mandatory_code")
+	for i := range names {
+		name := dictName(valueAt(names, i))
+		if len(name) == 0 {
+			continue
+		}
+		own := dictName(frame) == name
+		item := d.Items[name]
+		if item == nil {
+			item = &ItemDef{Name: name}
+			d.Items[name] = item
+		} else if !own {
+			// Don't let a parent's save frame override the data item's own
+			// definition.
+			if len(item.Category) == 0 {
+				item.Category = dictName(valueAt(cats, i))
+			}
+			continue
+		}
+		item.Category = dictName(valueAt(cats, i))
+		if len(item.Category) == 0 {
+			item.Category = tagCategory(name)
+		}
+		item.Mandatory = isYes(valueAt(mandatory, i))
+		item.Description = strings.TrimSpace(
+			dictValue(b, "item_description.description"))
+		item.Type = dictName(dictValue(b, "item_type.code"))
+		item.Units = dictName(dictValue(b, "item_units.code"))
+		item.Default = dictValue(b, "item_default.value")
+		item.Enumeration = dictValues(b, "item_enumeration.value")
+		item.Ranges = nil
+		item.Aliases = nil
+		for _, alias := range dictValues(b, "item_aliases.alias_name") {
+			item.Aliases = append(item.Aliases, dictName(alias))
+		}
+
+		mins := dictColumn(b, "item_range.minimum")
+		maxs := dictColumn(b, "item_range.maximum")
+		for j := range mins {
+			r := Range{Exclusive: true}
+			r.Min, r.HasMin = parseBound(mins[j])
+			r.Max, r.HasMax = parseBound(valueAt(maxs, j))
+			item.Ranges = append(item.Ranges, r)
+		}
+	}
+}
+
+// addType adds a type to the dictionary, compiling its construct.
+func (d *Dictionary) addType(td *TypeDef) {
+	if len(td.Construct) > 0 {
+		re, err := regexp.Compile("^(?:" + td.Construct + ")$")
+		if err == nil {
+			td.Regexp = re
+		}
+	}
+	d.Types[td.Code] = td
+}
+
+// addLink adds a link to the dictionary, unless it is already there. If the
+// link is already there without a group, then the group is recorded.
+func (d *Dictionary) addLink(link Link) {
+	if len(link.Child) == 0 || len(link.Parent) == 0 {
+		return
+	}
+	for i := range d.Links {
+		if d.Links[i].Child == link.Child && d.Links[i].Parent == link.Parent {
+			if len(d.Links[i].Group) == 0 {
+				d.Links[i].Group = link.Group
+			}
+			return
+		}
+	}
+	d.Links = append(d.Links, link)
+}
+
+// finish fills in the data items of each category, indexes the aliases of
+// data items and sorts the links, once every definition has been loaded.
+func (d *Dictionary) finish() {
+	for name, item := range d.Items {
+		if cat := d.Categories[item.Category]; cat != nil {
+			cat.Items = append(cat.Items, name)
+		}
+	}
+	d.aliases = d.aliasIndex()
+	for _, cat := range d.Categories {
+		sort.Strings(cat.Items)
+	}
+	sort.SliceStable(d.Links, func(i, j int) bool {
+		if d.Links[i].Child != d.Links[j].Child {
+			return d.Links[i].Child < d.Links[j].Child
+		}
+		return d.Links[i].Parent < d.Links[j].Parent
+	})
+}
+
+// firstBlock returns the first data block of cif, or nil if it has none.
+func firstBlock(cif *CIF) *DataBlock {
+	names := make([]string, 0, len(cif.Blocks))
+	for name := range cif.Blocks {
+		names = append(names, name)
+	}
+	names = ordered(cif.order, names, lessString)
+	if len(names) == 0 {
+		return nil
+	}
+	return cif.Blocks[names[0]]
+}
+
+// orderedFrames returns the save frames of a data block in the order in
+// which they were read.
+func orderedFrames(b *DataBlock) []*SaveFrame {
+	names := make([]string, 0, len(b.Frames))
+	for name := range b.Frames {
+		names = append(names, name)
+	}
+	frames := make([]*SaveFrame, 0, len(names))
+	for _, name := range ordered(b.frameOrder, names, lessString) {
+		frames = append(frames, b.Frames[name])
+	}
+	return frames
+}
+
+// dictColumn returns the text of every value of the data tag given, whether
+// it is a data item or a column of a table. Omitted and missing values are
+// included. If the data tag is not in the block, then nil is returned. The
+// slice may be shared with the block, so it must not be modified.
+func dictColumn(b *Block, tag string) []string {
+	if val, ok := b.Items[tag]; ok {
+		return []string{Text(val)}
+	}
+	if lp, ok := b.Loops[tag]; ok {
+		return columnTexts(lp.Get(tag))
+	}
+	return nil
+}
+
+// dictValues is like dictColumn, except omitted and missing values are
+// excluded.
+func dictValues(b *Block, tag string) []string {
+	var vals []string
+	for _, s := range dictColumn(b, tag) {
+		if !isNullText(s) {
+			vals = append(vals, s)
+		}
+	}
+	return vals
+}
+
+// dictValue returns the first value of the data tag given, or an empty
+// string if it has no values.
+func dictValue(b *Block, tag string) string {
+	return valueAt(dictValues(b, tag), 0)
+}
+
+// valueAt returns vals[i] if it exists and is not an omitted or missing
+// value. Otherwise, it returns vals[0] if vals has exactly one value (which
+// then applies to every row), or an empty string.
+func valueAt(vals []string, i int) string {
+	var s string
+	switch {
+	case i < len(vals):
+		s = vals[i]
+	case len(vals) == 1:
+		s = vals[0]
+	}
+	if isNullText(s) {
+		return ""
+	}
+	return s
+}
+
+// parseBound parses a bound of a range. Omitted and missing values (and
+// values that are not numbers) are not bounds.
+func parseBound(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// isYes returns true if s is a code meaning "yes" in a dictionary.
+func isYes(s string) bool {
+	s = strings.ToLower(s)
+	return s == "yes" || s == "y"
+}
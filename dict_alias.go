@@ -0,0 +1,212 @@
+package cif
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Canonical returns the data tag of the data item named by tag, which may be
+// one of the data item's aliases. If the data item has been replaced by
+// another (that is, its data tag is an alias of another data item), then the
+// data tag of the replacement is returned. Otherwise, tag is returned
+// unchanged (but in lowercase and without a leading underscore).
+func (d *Dictionary) Canonical(tag string) string {
+	tag = dictName(tag)
+	aliases := d.aliases
+	if aliases == nil {
+		aliases = d.aliasIndex()
+	}
+
+	// An alias may name a data item that has itself been replaced. The
+	// number of steps is bounded in case of a cycle.
+	for i := 0; i <= len(aliases); i++ {
+		name, ok := aliases[tag]
+		if !ok {
+			break
+		}
+		tag = name
+	}
+	return tag
+}
+
+// Names returns every data tag that names the same data item as tag: its
+// canonical data tag (see Canonical) followed by its aliases in sorted order.
+func (d *Dictionary) Names(tag string) []string {
+	canonical := d.Canonical(tag)
+	aliases := d.aliases
+	if aliases == nil {
+		aliases = d.aliasIndex()
+	}
+	names := make([]string, 0)
+	for alias := range aliases {
+		if d.Canonical(alias) == canonical {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{canonical}, names...)
+}
+
+// aliasIndex maps every alias of a data item to the data tag of the data
+// item.
+func (d *Dictionary) aliasIndex() map[string]string {
+	aliases := make(map[string]string)
+	for name, item := range d.Items {
+		for _, alias := range item.Aliases {
+			if alias != name {
+				aliases[alias] = name
+			}
+		}
+	}
+	return aliases
+}
+
+// ResolveTag returns the data tag under which the data item named by tag is
+// stored in the block. The data tag given is tried first, followed by every
+// name of the same data item in the dictionary (see Dictionary.Names). This
+// permits looking up data items by their current data tags in CIF files that
+// use older ones, and vice versa.
+//
+// If the data item is not in the block, then false is returned.
+func (b *Block) ResolveTag(tag string, d *Dictionary) (string, bool) {
+	tag = dictName(tag)
+	if b.hasTag(tag) {
+		return tag, true
+	}
+	for _, name := range d.Names(tag) {
+		if b.hasTag(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Lookup returns the value of the data item named by tag, where tag may be
+// any name of the data item in the dictionary (see ResolveTag). If the data
+// item is not in the block or is in a table, then false is returned.
+func (b *Block) Lookup(tag string, d *Dictionary) (Value, bool) {
+	name, ok := b.ResolveTag(tag, d)
+	if !ok {
+		return nil, false
+	}
+	val, ok := b.Items[name]
+	return val, ok
+}
+
+// LookupColumn returns the column of values of the data item named by tag,
+// where tag may be any name of the data item in the dictionary (see
+// ResolveTag). If the data item is not in a table of the block, then false
+// is returned.
+func (b *Block) LookupColumn(tag string, d *Dictionary) (ValueLoop, bool) {
+	name, ok := b.ResolveTag(tag, d)
+	if !ok {
+		return nil, false
+	}
+	lp, ok := b.Loops[name]
+	if !ok {
+		return nil, false
+	}
+	return lp.Get(name), true
+}
+
+// hasTag returns true if the data tag given is in the block, either in a
+// table or not.
+func (b *Block) hasTag(tag string) bool {
+	if _, ok := b.Items[tag]; ok {
+		return true
+	}
+	_, ok := b.Loops[tag]
+	return ok
+}
+
+// Migrate returns a new CIF in which every data tag that is an alias of a
+// data item in the dictionary is replaced with the data item's canonical
+// data tag (see Dictionary.Canonical). e.g., with the core dictionary,
+// "_symmetry_space_group_name_H-M" becomes "_space_group.name_H-M_alt". Data
+// tags that are not aliases are kept as they are. Save frames are migrated
+// too.
+//
+// Like with Select, the maps and tables of the new CIF are new, but the
+// values themselves are shared with cif.
+//
+// An error is returned if a data block or save frame contains more than one
+// name of the same data item, since only one of its values could be kept.
+func (cif *CIF) Migrate(d *Dictionary) (*CIF, error) {
+	migrated := &CIF{
+		Version: cif.Version,
+		Blocks:  make(map[string]*DataBlock, len(cif.Blocks)),
+		order:   cif.order,
+	}
+	for name, b := range cif.Blocks {
+		block, err := migrateBlock(&b.Block, d)
+		if err != nil {
+			return nil, fmt.Errorf("In data block '%s': %s", name, err)
+		}
+		nb := &DataBlock{
+			Block:      block,
+			Frames:     make(map[string]*SaveFrame, len(b.Frames)),
+			frameOrder: b.frameOrder,
+		}
+		for fname, frame := range b.Frames {
+			fblock, err := migrateBlock(&frame.Block, d)
+			if err != nil {
+				return nil, fmt.Errorf("In save frame '%s' of data block "+
+					"'%s': %s", fname, name, err)
+			}
+			nb.Frames[fname] = &SaveFrame{Block: fblock}
+		}
+		migrated.Blocks[name] = nb
+	}
+	return migrated, nil
+}
+
+// migrateBlock returns a copy of b in which every data tag is replaced with
+// its canonical data tag.
+func migrateBlock(b *Block, d *Dictionary) (Block, error) {
+	nb := Block{
+		Name:  b.Name,
+		Items: make(map[string]Value, len(b.Items)),
+		Loops: make(map[string]*Loop, len(b.Loops)),
+		order: make([]string, len(b.order)),
+	}
+	for i, tag := range b.order {
+		nb.order[i] = d.Canonical(tag)
+	}
+
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	seen := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		canonical := d.Canonical(tag)
+		if other, ok := seen[canonical]; ok {
+			return Block{}, fmt.Errorf("The data tags '%s' and '%s' both "+
+				"name the data item '%s'.", other, tag, canonical)
+		}
+		seen[canonical] = tag
+	}
+
+	for tag, val := range b.Items {
+		nb.Items[d.Canonical(tag)] = val
+	}
+	migrated := make(map[*Loop]*Loop, len(b.Loops))
+	for tag, lp := range b.Loops {
+		if _, ok := migrated[lp]; !ok {
+			nlp := &Loop{
+				Columns: make(map[string]int, len(lp.Columns)),
+				Values:  append([]ValueLoop(nil), lp.Values...),
+			}
+			for col, i := range lp.Columns {
+				nlp.Columns[d.Canonical(col)] = i
+			}
+			migrated[lp] = nlp
+		}
+		nb.Loops[d.Canonical(tag)] = migrated[lp]
+	}
+	return nb, nil
+}
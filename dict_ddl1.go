@@ -0,0 +1,181 @@
+package cif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ddl1Number is the construct of the "numb" type in DDL1 dictionaries. It
+// permits an optional standard uncertainty in parentheses.
+const ddl1Number = `[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?` +
+	`(\([0-9]+\))?`
+
+// LoadDDL1 builds a Dictionary from a DDL1 dictionary (like cif_core.dic)
+// that has been read with Read. In a DDL1 dictionary, every data block
+// defines one or more data items (named by "_name"), except for category
+// overviews (whose names end with "[]"), which describe a category.
+//
+// DDL1 types ("numb", "char" and "null") become the types of the Dictionary.
+// Data items with a "_type_construct" get a type of their own, named after
+// the data item. Ranges ("_enumeration_range") include their bounds. A data
+// item with "_list_mandatory" is mandatory, and the "_list_reference" of the
+// data items in a category are its keys. A data item that is replaced by
+// another ("_related_function" is "replace") becomes an alias of the data
+// item that replaces it.
+//
+// An error is returned if the CIF does not contain any definitions.
+func LoadDDL1(cif *CIF) (*Dictionary, error) {
+	d := &Dictionary{
+		Categories: make(map[string]*CategoryDef, 100),
+		Items:      make(map[string]*ItemDef, 1000),
+		Types:      make(map[string]*TypeDef, 10),
+		Units:      make(map[string]string, 50),
+	}
+	d.addType(&TypeDef{Code: "numb", Primitive: "numb", Construct: ddl1Number})
+	d.addType(&TypeDef{Code: "char", Primitive: "char"})
+	d.addType(&TypeDef{Code: "null", Primitive: "null"})
+
+	names := make([]string, 0, len(cif.Blocks))
+	for name := range cif.Blocks {
+		names = append(names, name)
+	}
+	names = ordered(cif.order, names, lessString)
+	for _, name := range names {
+		b := &cif.Blocks[name].Block
+		if title := dictValue(b, "dictionary_name"); len(title) > 0 {
+			d.Title = title
+			d.Version = dictValue(b, "dictionary_version")
+		}
+		d.loadDDL1Block(b)
+	}
+	if len(d.Items) == 0 {
+		return nil, fmt.Errorf("The dictionary does not define any data " +
+			"items.")
+	}
+	for _, name := range names {
+		d.loadDDL1Aliases(&cif.Blocks[name].Block)
+	}
+
+	d.finish()
+	return d, nil
+}
+
+// loadDDL1Block loads the data items or category defined in a single data
+// block of a DDL1 dictionary.
+func (d *Dictionary) loadDDL1Block(b *Block) {
+	names := dictColumn(b, "name")
+	cats := dictColumn(b, "category")
+	typ := strings.ToLower(dictValue(b, "type"))
+	for i := range names {
+		name := dictName(valueAt(names, i))
+		if len(name) == 0 {
+			continue
+		}
+		if strings.HasSuffix(name, "[]") {
+			d.loadDDL1Category(b, name)
+			continue
+		}
+		item := &ItemDef{
+			Name:        name,
+			Category:    dictName(valueAt(cats, i)),
+			Description: strings.TrimSpace(dictValue(b, "definition")),
+			Mandatory:   isYes(dictValue(b, "list_mandatory")),
+			Type:        typ,
+			Units:       dictName(dictValue(b, "units")),
+			Default:     dictValue(b, "enumeration_default"),
+			Enumeration: dictValues(b, "enumeration"),
+			List:        strings.ToLower(dictValue(b, "list")),
+		}
+		if len(item.Category) == 0 {
+			item.Category = tagCategory(name)
+		}
+		if construct := dictValue(b, "type_construct"); len(construct) > 0 {
+			item.Type = name
+			d.addType(&TypeDef{
+				Code:      name,
+				Primitive: typ,
+				Construct: strings.TrimSpace(construct),
+			})
+		}
+		if len(item.Units) > 0 {
+			d.Units[item.Units] = strings.TrimSpace(
+				dictValue(b, "units_detail"))
+		}
+		for _, rng := range dictValues(b, "enumeration_range") {
+			if r, ok := parseDDL1Range(rng); ok {
+				item.Ranges = append(item.Ranges, r)
+			}
+		}
+		for _, parent := range dictValues(b, "list_link_parent") {
+			d.addLink(Link{Child: name, Parent: dictName(parent)})
+		}
+		d.Items[name] = item
+
+		cat := d.ddl1Category(item.Category)
+		for _, ref := range dictValues(b, "list_reference") {
+			ref = dictName(ref)
+			if !isEnumerated(cat.Keys, ref, false) {
+				cat.Keys = append(cat.Keys, ref)
+			}
+		}
+	}
+}
+
+// loadDDL1Aliases records the data items defined in a single data block as
+// aliases of the data items that replace them. This is done after every
+// definition has been loaded, since a data item may be replaced by one that
+// is defined later.
+func (d *Dictionary) loadDDL1Aliases(b *Block) {
+	related := dictColumn(b, "related_item")
+	functions := dictColumn(b, "related_function")
+	for i := range related {
+		if !strings.EqualFold(valueAt(functions, i), "replace") {
+			continue
+		}
+		item := d.Items[dictName(valueAt(related, i))]
+		if item == nil {
+			continue
+		}
+		for _, name := range dictValues(b, "name") {
+			name = dictName(name)
+			if name != item.Name && !isEnumerated(item.Aliases, name, false) {
+				item.Aliases = append(item.Aliases, name)
+			}
+		}
+	}
+}
+
+// loadDDL1Category loads a category overview, whose name (like
+// "atom_site_[]") ends with "[]".
+func (d *Dictionary) loadDDL1Category(b *Block, name string) {
+	catName := dictName(dictValue(b, "category"))
+	if len(catName) == 0 || catName == "category_overview" {
+		catName = strings.TrimRight(strings.TrimSuffix(name, "[]"), "_")
+	}
+	cat := d.ddl1Category(catName)
+	cat.Description = strings.TrimSpace(dictValue(b, "definition"))
+}
+
+// ddl1Category returns the category with the name given, creating it if it
+// doesn't exist yet.
+func (d *Dictionary) ddl1Category(name string) *CategoryDef {
+	cat := d.Categories[name]
+	if cat == nil {
+		cat = &CategoryDef{Name: name}
+		d.Categories[name] = cat
+	}
+	return cat
+}
+
+// parseDDL1Range parses a range in DDL1 notation, "min:max", where either
+// bound may be omitted. e.g., "0.0:" or "1:10".
+func parseDDL1Range(s string) (Range, bool) {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return Range{}, false
+	}
+	var r Range
+	r.Min, r.HasMin = parseBound(s[:i])
+	r.Max, r.HasMax = parseBound(s[i+1:])
+	return r, r.HasMin || r.HasMax
+}
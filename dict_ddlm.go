@@ -0,0 +1,424 @@
+package cif
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ddlmTypes contains the DDLm contents codes that have a construct, along
+// with their primitive types. Every other contents code gets a type without
+// a construct (that matches every value) when it is first used.
+var ddlmTypes = []*TypeDef{
+	{Code: "integer", Primitive: "numb", Construct: `[+-]?[0-9]+`},
+	{Code: "real", Primitive: "numb", Construct: ddl1Number},
+	{Code: "count", Primitive: "numb", Construct: `[+]?[0-9]+`},
+	{Code: "index", Primitive: "numb", Construct: `[+]?0*[1-9][0-9]*`},
+	{Code: "code", Primitive: "uchar", Construct: `[^ \t\r\n]+`},
+	{Code: "word", Primitive: "char", Construct: `[^ \t\r\n]+`},
+	{Code: "tag", Primitive: "uchar", Construct: `_[^ \t\r\n]+`},
+	{Code: "date", Primitive: "char", Construct: `[0-9]{4}-[0-9]{2}-[0-9]{2}`},
+}
+
+// LoadDDLm builds a Dictionary from a DDLm dictionary (like cif_core.dic
+// version 3), which is typically written in CIF 2.0 and has been read with
+// Read. Every save frame of the dictionary's first data block defines either
+// a category ("_definition.scope" is "Category") or a data item.
+//
+// Before building the Dictionary, every "_import.get" is resolved by reading
+// the files it refers to from the directory dir (or a directory below it;
+// files outside of dir are never read). An import in "Contents" mode (the
+// default) copies the data items of a save frame into the importing save
+// frame, while an import in "Full" mode copies every save frame of the
+// imported dictionary into this one (with the categories below its head
+// category placed below the importing category). The "if_dupl" and "if_miss"
+// options are honored. Imports are resolved in place, so cif is modified.
+//
+// DDLm contents codes become the types of the Dictionary. Ranges
+// ("_enumeration.range") include their bounds. Links come from
+// "_name.linked_item_id" and aliases come from "_alias.definition_id".
+func LoadDDLm(cif *CIF, dir string) (*Dictionary, error) {
+	block := firstBlock(cif)
+	if block == nil {
+		return nil, fmt.Errorf("The dictionary has no data blocks.")
+	}
+	im := &importer{
+		dir:     dir,
+		files:   make(map[string]*DataBlock, 10),
+		loading: make(map[string]bool, 10),
+	}
+	if err := im.resolveBlock(block); err != nil {
+		return nil, err
+	}
+
+	d := &Dictionary{
+		Title:      dictValue(&block.Block, "dictionary.title"),
+		Version:    dictValue(&block.Block, "dictionary.version"),
+		Categories: make(map[string]*CategoryDef, 100),
+		Items:      make(map[string]*ItemDef, 1000),
+		Types:      make(map[string]*TypeDef, 20),
+		Units:      make(map[string]string, 50),
+	}
+	for _, td := range ddlmTypes {
+		cpy := *td
+		d.addType(&cpy)
+	}
+	for _, frame := range orderedFrames(block) {
+		d.loadDDLmFrame(&frame.Block)
+	}
+	if len(d.Categories) == 0 && len(d.Items) == 0 {
+		return nil, fmt.Errorf("The dictionary '%s' does not define any "+
+			"categories or data items.", block.Name)
+	}
+	d.finish()
+	return d, nil
+}
+
+// loadDDLmFrame loads the category or data item defined in a save frame.
+func (d *Dictionary) loadDDLmFrame(b *Block) {
+	id := dictName(dictValue(b, "definition.id"))
+	parent := dictName(dictValue(b, "name.category_id"))
+	if len(id) == 0 {
+		return
+	}
+	description := strings.TrimSpace(dictValue(b, "description.text"))
+	if strings.EqualFold(dictValue(b, "definition.scope"), "category") {
+		cat := &CategoryDef{
+			Name:        id,
+			Description: description,
+			Parent:      parent,
+			Class:       dictValue(b, "definition.class"),
+		}
+		for _, key := range dictValues(b, "category_key.name") {
+			cat.Keys = append(cat.Keys, dictName(key))
+		}
+		d.Categories[id] = cat
+		return
+	}
+
+	item := &ItemDef{
+		Name:        id,
+		Category:    parent,
+		Description: description,
+		Units:       dictName(dictValue(b, "units.code")),
+		Default:     dictValue(b, "enumeration.default"),
+		Enumeration: dictValues(b, "enumeration_set.state"),
+		Container:   dictValue(b, "type.container"),
+		Contents:    dictValue(b, "type.contents"),
+		Purpose:     dictValue(b, "type.purpose"),
+	}
+	if len(item.Category) == 0 {
+		item.Category = tagCategory(id)
+	}
+	if len(item.Container) == 0 {
+		item.Container = "Single"
+	}
+	if len(item.Contents) > 0 {
+		item.Type = strings.ToLower(item.Contents)
+		if d.Types[item.Type] == nil {
+			d.addType(&TypeDef{Code: item.Type, Primitive: "char"})
+		}
+	}
+	for _, rng := range dictValues(b, "enumeration.range") {
+		if r, ok := parseDDL1Range(rng); ok {
+			item.Ranges = append(item.Ranges, r)
+		}
+	}
+	for _, alias := range dictValues(b, "alias.definition_id") {
+		item.Aliases = append(item.Aliases, dictName(alias))
+	}
+	if linked := dictValue(b, "name.linked_item_id"); len(linked) > 0 {
+		d.addLink(Link{Child: id, Parent: dictName(linked)})
+	}
+	d.Items[id] = item
+}
+
+// SubCategories returns the names of the categories whose parent is the
+// category given, in sorted order.
+func (d *Dictionary) SubCategories(name string) []string {
+	name = dictName(name)
+	subs := make([]string, 0)
+	for _, cat := range d.Categories {
+		if cat.Parent == name && cat.Name != name {
+			subs = append(subs, cat.Name)
+		}
+	}
+	sort.Strings(subs)
+	return subs
+}
+
+// importer resolves the "_import.get" directives of DDLm dictionaries.
+type importer struct {
+	// dir is the directory containing the files that may be imported.
+	dir string
+
+	// files maps file names to the first data block of each file read so
+	// far, with its imports resolved.
+	files map[string]*DataBlock
+
+	// loading contains the files whose imports are being resolved, so that
+	// circular imports can be detected.
+	loading map[string]bool
+}
+
+// resolveBlock resolves the imports of every save frame in a data block.
+func (im *importer) resolveBlock(b *DataBlock) error {
+	for _, frame := range orderedFrames(b) {
+		if err := im.resolveFrame(b, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveFrame resolves the imports of a single save frame, and then removes
+// its "_import.get" data item.
+func (im *importer) resolveFrame(b *DataBlock, frame *SaveFrame) error {
+	val, ok := frame.Items["import.get"]
+	if !ok {
+		return nil
+	}
+	specs, ok := val.Raw().([]Value)
+	if !ok {
+		return fmt.Errorf("In save frame '%s', _import.get must be a list "+
+			"of tables, but it is '%s'.", frame.Name, Text(val))
+	}
+	delete(frame.Items, "import.get")
+
+	for _, spec := range specs {
+		table, ok := spec.Raw().(map[string]Value)
+		if !ok {
+			return fmt.Errorf("In save frame '%s', _import.get must be a "+
+				"list of tables, but it contains '%s'.",
+				frame.Name, Text(spec))
+		}
+		opt := func(key, def string) string {
+			if v, ok := table[key]; ok {
+				return strings.ToLower(Text(v))
+			}
+			return def
+		}
+		save, mode := opt("save", ""), opt("mode", "contents")
+		ifDupl, ifMiss := opt("if_dupl", "exit"), opt("if_miss", "exit")
+		file := ""
+		if v, ok := table["file"]; ok {
+			file = Text(v) // file names are case sensitive
+		}
+
+		src, err := im.load(file)
+		if err != nil {
+			if ifMiss == "ignore" {
+				continue
+			}
+			return fmt.Errorf("In save frame '%s': %s", frame.Name, err)
+		}
+		if mode == "full" {
+			err = im.importFull(b, frame, src, ifDupl)
+		} else {
+			err = im.importContents(frame, src, save, ifDupl, ifMiss)
+		}
+		if err != nil {
+			return fmt.Errorf("In save frame '%s': %s", frame.Name, err)
+		}
+	}
+	return nil
+}
+
+// importContents copies the data items of the save frame named save in src
+// into frame.
+func (im *importer) importContents(frame *SaveFrame, src *DataBlock,
+	save, ifDupl, ifMiss string) error {
+
+	from := src.Frames[save]
+	if from == nil {
+		if ifMiss == "ignore" {
+			return nil
+		}
+		return fmt.Errorf("Could not find save frame '%s' to import from "+
+			"'%s'.", save, src.Name)
+	}
+	return mergeBlock(&frame.Block, &from.Block, ifDupl)
+}
+
+// importFull copies every save frame of src into b. The categories directly
+// below the head category of src are placed below the category defined by
+// frame instead, and the head category itself is not copied.
+func (im *importer) importFull(b *DataBlock, frame *SaveFrame,
+	src *DataBlock, ifDupl string) error {
+
+	head := ""
+	for _, from := range orderedFrames(src) {
+		if strings.EqualFold(dictValue(&from.Block, "definition.class"),
+			"head") {
+			head = dictName(dictValue(&from.Block, "definition.id"))
+		}
+	}
+	parent := dictValue(&frame.Block, "definition.id")
+	for _, from := range orderedFrames(src) {
+		if len(head) > 0 &&
+			dictName(dictValue(&from.Block, "definition.id")) == head {
+			continue
+		}
+		if _, ok := b.Frames[from.Name]; ok {
+			switch ifDupl {
+			case "ignore":
+				continue
+			case "replace":
+			default:
+				return fmt.Errorf("Save frame '%s' from '%s' already "+
+					"exists.", from.Name, src.Name)
+			}
+		} else {
+			b.frameOrder = append(b.frameOrder, from.Name)
+		}
+
+		cpy := &SaveFrame{Block: copyBlock(&from.Block)}
+		if len(head) > 0 &&
+			dictName(dictValue(&cpy.Block, "name.category_id")) == head {
+			cpy.Items["name.category_id"] = AsValue(parent)
+		}
+		b.Frames[from.Name] = cpy
+	}
+	return nil
+}
+
+// load reads the file given from the importer's directory and resolves its
+// imports. Each file is only read once.
+func (im *importer) load(file string) (*DataBlock, error) {
+	if b, ok := im.files[file]; ok {
+		return b, nil
+	}
+	if len(file) == 0 {
+		return nil, fmt.Errorf("An import does not name a file.")
+	}
+	if im.loading[file] {
+		return nil, fmt.Errorf("The file '%s' imports itself.", file)
+	}
+	im.loading[file] = true
+	defer delete(im.loading, file)
+
+	// Files outside of the directory cannot be imported, so that a dictionary
+	// can't read arbitrary files with an import like "../../etc/passwd".
+	path := filepath.Join(im.dir, filepath.FromSlash(file))
+	rel, err := filepath.Rel(im.dir, path)
+	if err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+
+		return nil, fmt.Errorf("The file '%s' is outside of the directory "+
+			"'%s'.", file, im.dir)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cif, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read '%s': %s", file, err)
+	}
+	b := firstBlock(cif)
+	if b == nil {
+		return nil, fmt.Errorf("The file '%s' has no data blocks.", file)
+	}
+	if err := im.resolveBlock(b); err != nil {
+		return nil, err
+	}
+	im.files[file] = b
+	return b, nil
+}
+
+// mergeBlock copies the data items and tables of src into dst. A table is
+// copied as a whole. When a data tag is in both blocks, ifDupl determines
+// whether dst keeps its own ("ignore"), takes the one from src ("replace") or
+// an error is returned ("exit").
+func mergeBlock(dst, src *Block, ifDupl string) error {
+	tags := make([]string, 0, len(src.Items)+len(src.Loops))
+	for tag := range src.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range src.Loops {
+		tags = append(tags, tag)
+	}
+	merged := make(map[*Loop]bool, len(src.Loops))
+	for _, tag := range ordered(src.order, tags, lessTag) {
+		lp := src.Loops[tag]
+		if lp != nil && merged[lp] {
+			continue
+		}
+		merged[lp] = true
+
+		group := []string{tag}
+		if lp != nil {
+			group = loopTags(lp)
+		}
+		dupl := false
+		for _, t := range group {
+			_, iok := dst.Items[t]
+			_, lok := dst.Loops[t]
+			dupl = dupl || iok || lok
+		}
+		if dupl {
+			switch ifDupl {
+			case "ignore":
+				continue
+			case "replace":
+				for _, t := range group {
+					removeTag(dst, t)
+				}
+			default:
+				return fmt.Errorf("The data tag '%s' is defined twice.", tag)
+			}
+		}
+		for _, t := range group {
+			if lp != nil {
+				dst.Loops[t] = lp
+			} else {
+				dst.Items[t] = src.Items[t]
+			}
+			dst.order = append(dst.order, t)
+		}
+	}
+	return nil
+}
+
+// removeTag removes a data tag from a block. If the data tag is part of a
+// table, then the whole table is removed.
+func removeTag(b *Block, tag string) {
+	delete(b.Items, tag)
+	if lp, ok := b.Loops[tag]; ok {
+		for _, t := range loopTags(lp) {
+			delete(b.Loops, t)
+		}
+	}
+}
+
+// loopTags returns the data tags of a table in the order of its columns.
+func loopTags(lp *Loop) []string {
+	tags := make([]string, 0, len(lp.Columns))
+	for tag := range lp.Columns {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return lp.Columns[tags[i]] < lp.Columns[tags[j]]
+	})
+	return tags
+}
+
+// copyBlock returns a copy of b with new maps. Values and tables are shared.
+func copyBlock(b *Block) Block {
+	cpy := Block{
+		Name:  b.Name,
+		Items: make(map[string]Value, len(b.Items)),
+		Loops: make(map[string]*Loop, len(b.Loops)),
+		order: append([]string(nil), b.order...),
+	}
+	for tag, val := range b.Items {
+		cpy.Items[tag] = val
+	}
+	for tag, lp := range b.Loops {
+		cpy.Loops[tag] = lp
+	}
+	return cpy
+}
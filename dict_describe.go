@@ -0,0 +1,131 @@
+package cif
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// describeIndent is the indentation of values (and of prose) in the
+// documentation returned by Describe.
+const describeIndent = "             "
+
+// Describe returns documentation of the data item with the tag given, as
+// plain text for reading in a terminal. It contains the data item's
+// description, its type, units, default value, permitted values and ranges,
+// its aliases, the category it belongs to (with the category's keys and
+// description) and the data items it is linked to as a child or parent.
+// Only the information defined in the dictionary is included. (So a data
+// item is only described as mandatory when it is.)
+//
+// The tag may be an alias of the data item (see Canonical). An error is
+// returned if the data item is not in the dictionary.
+func (d *Dictionary) Describe(tag string) (string, error) {
+	name := d.Canonical(tag)
+	item := d.Items[name]
+	if item == nil {
+		return "", fmt.Errorf("The data item '%s' is not in the dictionary.",
+			tag)
+	}
+
+	buf := new(bytes.Buffer)
+	field := func(label string, lines ...string) {
+		if len(lines) == 0 || len(lines[0]) == 0 {
+			return
+		}
+		fmt.Fprintf(buf, "%-13s%s\n", label+":", lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(buf, "%s%s\n", describeIndent, line)
+		}
+	}
+
+	field("Data item", "_"+item.Name)
+	field("Aliases", underscored(item.Aliases)...)
+	cat := d.Categories[item.Category]
+	if cat != nil && len(cat.Keys) > 0 {
+		field("Category", fmt.Sprintf("%s (keys: %s)",
+			item.Category, strings.Join(underscored(cat.Keys), ", ")))
+	} else {
+		field("Category", item.Category)
+	}
+	if typ := d.Types[item.Type]; typ != nil && len(typ.Primitive) > 0 &&
+		typ.Primitive != typ.Code {
+
+		field("Type", fmt.Sprintf("%s (%s)", item.Type, typ.Primitive))
+	} else {
+		field("Type", item.Type)
+	}
+	if typ := d.Types[item.Type]; typ != nil {
+		field("Construct", typ.Construct)
+		field("Type detail", describeLines(typ.Detail)...)
+	}
+	if item.Container != "" && item.Container != "Single" {
+		field("Container", item.Container)
+	}
+	field("Purpose", item.Purpose)
+	if detail := d.Units[item.Units]; len(detail) > 0 {
+		field("Units", fmt.Sprintf("%s (%s)", item.Units, detail))
+	} else {
+		field("Units", item.Units)
+	}
+	if item.Mandatory {
+		field("Mandatory", "yes")
+	}
+	field("List", item.List)
+	field("Default", item.Default)
+	field("Enumeration", item.Enumeration...)
+	ranges := make([]string, len(item.Ranges))
+	for i, r := range item.Ranges {
+		ranges[i] = r.String()
+		if r.Exclusive && (!r.HasMin || !r.HasMax || r.Min != r.Max) {
+			ranges[i] += " (exclusive)"
+		}
+	}
+	field("Ranges", ranges...)
+	field("Parents", underscored(d.Parents(name))...)
+	field("Children", underscored(d.Children(name))...)
+
+	if len(item.Description) > 0 {
+		fmt.Fprintf(buf, "\nDescription:\n%s",
+			describeText(item.Description))
+	}
+	if cat != nil && len(cat.Description) > 0 {
+		fmt.Fprintf(buf, "\nCategory %s:\n%s", cat.Name,
+			describeText(cat.Description))
+	}
+	return buf.String(), nil
+}
+
+// describeText returns prose filled to fit within 80 columns, indented like
+// the values in the documentation returned by Describe.
+func describeText(s string) string {
+	return fillText(s, describeIndent, 80-len(describeIndent))
+}
+
+// describeLines returns the lines of prose filled by describeText, without
+// their indentation.
+func describeLines(s string) []string {
+	text := strings.TrimSuffix(fillText(s, "", 80-len(describeIndent)), "\n")
+	if len(text) == 0 {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// underscored returns the data tags given with a leading underscore, as
+// they are written in CIF files.
+func underscored(tags []string) []string {
+	with := make([]string, len(tags))
+	for i, tag := range tags {
+		with[i] = "_" + tag
+	}
+	return with
+}
+
+// yesNo returns "yes" if b is true and "no" otherwise.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,254 @@
+package cif
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GoOptions controls the Go source code written by WriteGo.
+type GoOptions struct {
+	// Package is the name of the package of the Go source code.
+	Package string
+
+	// Categories contains the names of the categories to write types for.
+	// If it is empty, then a type is written for every category with at
+	// least one data item.
+	Categories []string
+
+	// Pointers, when true, makes the type of every field a pointer (like
+	// *float64), so that Block.Unmarshal can set missing and omitted values
+	// to nil instead of the zero value.
+	Pointers bool
+}
+
+// WriteGo writes Go source code declaring a struct type for each category of
+// the dictionary. Each struct has a field for every data item in the
+// category, with a struct tag of the form `cif:"atom_site.cartn_x"` naming
+// its data tag. Types and fields are documented with the descriptions in the
+// dictionary.
+//
+// Type and field names are the category names and data tags in CamelCase,
+// without the category name in field names. e.g., the data item
+// "_atom_site.Cartn_x" becomes the field CartnX of the type AtomSite. (For
+// data tags without a '.', like those of DDL1 dictionaries, the category
+// name is removed when it is a prefix of the data tag.) The types of fields
+// are int, float64 or string (or pointers to them, with GoOptions.Pointers),
+// according to the types of data items (as described for ReadOptions).
+// Values of the types may be read from a block with Block.Unmarshal.
+//
+// The source code is formatted with gofmt and starts with a comment marking
+// it as generated, so it may be written by "go generate". Types and fields
+// are written in sorted order.
+//
+// An error is returned if a category given in the options is not in the
+// dictionary.
+func (d *Dictionary) WriteGo(w io.Writer, opts GoOptions) error {
+	names := make([]string, 0, len(d.Categories))
+	if len(opts.Categories) == 0 {
+		for name, cat := range d.Categories {
+			if len(cat.Items) > 0 {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, name := range opts.Categories {
+			if d.Category(name) == nil {
+				return fmt.Errorf("The category '%s' is not in the "+
+					"dictionary.", name)
+			}
+			names = append(names, dictName(name))
+		}
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated from the CIF dictionary %s. "+
+		"DO NOT EDIT.\n\n", d.describeVersion())
+	fmt.Fprintf(buf, "package %s\n", opts.Package)
+
+	types := make(map[string]bool, len(names))
+	for _, name := range names {
+		cat := d.Categories[name]
+		typ := uniqueName(types, goName(name))
+		fmt.Fprintf(buf, "\n// %s contains the data items of the category "+
+			"\"%s\".\n", typ, name)
+		if desc := goComment(cat.Description, ""); len(desc) > 0 {
+			fmt.Fprintf(buf, "//\n%s", desc)
+		}
+		fmt.Fprintf(buf, "type %s struct {\n", typ)
+
+		// Fields are separated by blank lines only when documented.
+		fields := make(map[string]bool, len(cat.Items))
+		prevDoc := false
+		for i, tag := range cat.Items {
+			item := d.Items[tag]
+			doc := goComment(item.Description, "\t")
+			if i > 0 && (len(doc) > 0 || prevDoc) {
+				buf.WriteByte('\n')
+			}
+			prevDoc = len(doc) > 0
+			buf.WriteString(doc)
+			typ := goType(item)
+			if opts.Pointers {
+				typ = "*" + typ
+			}
+			fmt.Fprintf(buf, "\t%s %s %s\n",
+				uniqueName(fields, goName(fieldName(name, tag))),
+				typ, goStructTag(tag))
+		}
+		buf.WriteString("}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("Could not format the Go source code: %s", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// describeVersion returns the title and version of the dictionary, for
+// identifying it in the generated source code.
+func (d *Dictionary) describeVersion() string {
+	title := d.Title
+	if len(title) == 0 {
+		title = "(untitled)"
+	}
+	if len(d.Version) == 0 {
+		return title
+	}
+	return fmt.Sprintf("%s (version %s)", title, d.Version)
+}
+
+// goInitialisms contains the words that are written in uppercase in Go
+// names, following the conventions of Go.
+var goInitialisms = map[string]bool{
+	"id": true, "url": true, "doi": true, "pdb": true,
+}
+
+// goName returns a Go name in CamelCase for a category name or data tag.
+// Every run of letters and digits is a word. e.g., "name_h-m_alt" becomes
+// "NameHMAlt".
+func goName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var name bytes.Buffer
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if goInitialisms[word] {
+			name.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r := []rune(word)
+		r[0] = unicode.ToUpper(r[0])
+		name.WriteString(string(r))
+	}
+	if name.Len() == 0 || !unicode.IsLetter([]rune(name.String())[0]) {
+		return "X" + name.String()
+	}
+	return name.String()
+}
+
+// fieldName returns the part of a data tag that names it within its
+// category.
+func fieldName(category, tag string) string {
+	if i := strings.IndexByte(tag, '.'); i > -1 {
+		return tag[i+1:]
+	}
+	if strings.HasPrefix(tag, category+"_") {
+		return tag[len(category)+1:]
+	}
+	return tag
+}
+
+// uniqueName returns the name given, or the name followed by a number if it
+// has already been used. The name returned is marked as used.
+func uniqueName(used map[string]bool, name string) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// goType returns the Go type of the values of a data item.
+func goType(item *ItemDef) string {
+	switch itemKind(item) {
+	case itemDataInteger:
+		return "int"
+	case itemDataFloat:
+		return "float64"
+	}
+	return "string"
+}
+
+// goStructTag returns the struct tag, as a Go string literal, of the field
+// for a data tag.
+func goStructTag(tag string) string {
+	st := "cif:" + strconv.Quote(tag)
+	if strings.ContainsRune(st, '`') {
+		return strconv.Quote(st)
+	}
+	return "`" + st + "`"
+}
+
+// goComment returns the description given as Go comment lines with the
+// indent given, with each paragraph filled to fit within 80 columns. An
+// empty description has no lines.
+func goComment(desc, indent string) string {
+	return fillText(desc, indent+"// ", 77-8*len(indent))
+}
+
+// fillText returns prose with each paragraph filled to lines of no more than
+// width characters, where every line also starts with the prefix given
+// (which doesn't count towards the width). Paragraphs are separated by a
+// line with only the prefix (without trailing spaces). Empty prose has no
+// lines.
+func fillText(s, prefix string, width int) string {
+	var buf bytes.Buffer
+	for i, para := range paragraphs(s) {
+		if i > 0 {
+			buf.WriteString(strings.TrimRight(prefix, " ") + "\n")
+		}
+		line := ""
+		for _, word := range para {
+			if len(line) > 0 && len(line)+1+len(word) > width {
+				buf.WriteString(prefix + line + "\n")
+				line = ""
+			}
+			if len(line) > 0 {
+				line += " "
+			}
+			line += word
+		}
+		buf.WriteString(prefix + line + "\n")
+	}
+	return buf.String()
+}
+
+// paragraphs splits prose into paragraphs (separated by blank lines) of
+// words.
+func paragraphs(s string) [][]string {
+	paras := make([][]string, 0)
+	var para []string
+	for _, line := range strings.Split(s, "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 && len(para) > 0 {
+			paras = append(paras, para)
+			para = nil
+		}
+		para = append(para, words...)
+	}
+	if len(para) > 0 {
+		paras = append(paras, para)
+	}
+	return paras
+}
@@ -0,0 +1,623 @@
+package cif
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenerateOptions controls the CIF data produced by Generate.
+type GenerateOptions struct {
+	// Categories contains the names of the categories to generate data
+	// items for. If it is empty, then every category with at least one data
+	// item is generated. In either case, the mandatory categories of the
+	// dictionary and the categories of the parents of every generated data
+	// item are generated too.
+	Categories []string
+
+	// Rows is the number of rows in each table. If it is 0, then 3 rows are
+	// generated. Fewer rows are generated when there are not enough distinct
+	// values for the keys of a category.
+	Rows int
+
+	// Seed seeds the random values. The same options (and dictionary)
+	// always produce the same CIF.
+	Seed int64
+
+	// Block is the name of the generated data block. If it is empty, then
+	// "synthetic" is used.
+	Block string
+}
+
+// quotingCases contains strings that are difficult to write in CIF files.
+// They are used (when they match the type of a data item) to test the
+// quoting of values.
+var quotingCases = []string{
+	"it's", `"quoted"`, "'quoted'", `it's "both"`, "it' s", `it" s`,
+	"two words", "'", `"`, "", "#hash", "$frame", "_tag", "[bracket",
+	"]bracket", ";semicolon", "a;b", "data_block", "loop_", "save_frame",
+	"global_", "stop_", "Loop_", "DATA_", "two\nlines", "line\n;semicolon",
+	"' '", `" "`, "tab\there", "trailing ",
+}
+
+// Generate produces a random but valid CIF with a single data block
+// containing the data items of categories in a dictionary. Categories with a
+// DDLm class of "Set", or with a data item that must not be in a table (see
+// ItemDef.List), have a single value for each data item. Every other
+// category is generated as a table.
+//
+// Every value is valid according to Validate: it matches the regular
+// expression of its type, is one of its enumerated values (if any) and falls
+// in one of its ranges (if any). The keys of each category are unique, and
+// every child data item (see Dictionary.Links) only has values of its parent
+// (with linked children in a group taken from the same row of the parents).
+// String values are sometimes chosen from strings that are difficult to
+// quote, and the values of data items that are neither mandatory nor keys nor
+// linked are sometimes omitted (".") or missing ("?"). Data items that have
+// been replaced by others (see Dictionary.Canonical) and DDLm data items
+// whose container is not "Single" are not generated.
+//
+// Generate is deterministic: the same seed always produces the same CIF.
+//
+// An error is returned if a category given is not in the dictionary, or if
+// no valid value can be found for a data item (e.g., because its type has a
+// regular expression that cannot be used to generate values).
+func Generate(d *Dictionary, opts GenerateOptions) (*CIF, error) {
+	g := &generator{
+		d:      d,
+		rand:   rand.New(rand.NewSource(opts.Seed)),
+		rows:   opts.Rows,
+		values: make(map[string][]string, 100),
+		types:  make(map[string]*syntax.Regexp, 20),
+	}
+	if g.rows <= 0 {
+		g.rows = 3
+	}
+	name := strings.ToLower(opts.Block)
+	if len(name) == 0 {
+		name = "synthetic"
+	}
+
+	cats, err := g.categories(opts.Categories)
+	if err != nil {
+		return nil, err
+	}
+	b := &DataBlock{
+		Block: Block{
+			Name:  name,
+			Items: make(map[string]Value, 20),
+			Loops: make(map[string]*Loop, 20),
+		},
+		Frames: make(map[string]*SaveFrame),
+	}
+	for _, cat := range cats {
+		if err := g.category(&b.Block, d.Categories[cat]); err != nil {
+			return nil, err
+		}
+	}
+	return &CIF{
+		Version: "CIF_1.1",
+		Blocks:  map[string]*DataBlock{name: b},
+		order:   []string{name},
+	}, nil
+}
+
+type generator struct {
+	d    *Dictionary
+	rand *rand.Rand
+	rows int
+
+	// values maps the data tags generated so far to their values.
+	values map[string][]string
+
+	// types maps type codes to their parsed regular expressions, or nil if
+	// a type has none.
+	types map[string]*syntax.Regexp
+}
+
+// categories returns the names of the categories to generate, in an order
+// such that the parents of data items are generated before their children
+// (except for cycles).
+func (g *generator) categories(names []string) ([]string, error) {
+	wanted := make(map[string]bool, len(g.d.Categories))
+	if len(names) == 0 {
+		for name, cat := range g.d.Categories {
+			if len(cat.Items) > 0 {
+				wanted[name] = true
+			}
+		}
+	}
+	for _, name := range names {
+		if g.d.Category(name) == nil {
+			return nil, fmt.Errorf("The category '%s' is not in the "+
+				"dictionary.", name)
+		}
+		wanted[dictName(name)] = true
+	}
+	for name, cat := range g.d.Categories {
+		if cat.Mandatory {
+			wanted[name] = true
+		}
+	}
+
+	// parents maps each category to the categories of the parents of its
+	// data items.
+	parents := make(map[string][]string, len(g.d.Categories))
+	for _, link := range g.d.Links {
+		child, parent := g.d.Items[link.Child], g.d.Items[link.Parent]
+		if child == nil || parent == nil || child.Category == parent.Category {
+			continue
+		}
+		if g.d.Categories[parent.Category] == nil {
+			continue
+		}
+		parents[child.Category] = append(parents[child.Category],
+			parent.Category)
+	}
+	for changed := true; changed; {
+		changed = false
+		for name := range wanted {
+			for _, parent := range parents[name] {
+				if !wanted[parent] {
+					wanted[parent], changed = true, true
+				}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(wanted))
+	for name := range wanted {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	// Visit the categories in depth first order, parents first.
+	order := make([]string, 0, len(sorted))
+	state := make(map[string]int, len(sorted)) // 1 = visiting, 2 = visited
+	var visit func(name string)
+	visit = func(name string) {
+		if state[name] > 0 {
+			return
+		}
+		state[name] = 1
+		ps := append([]string(nil), parents[name]...)
+		sort.Strings(ps)
+		for _, parent := range ps {
+			visit(parent)
+		}
+		state[name] = 2
+		order = append(order, name)
+	}
+	for _, name := range sorted {
+		visit(name)
+	}
+	return order, nil
+}
+
+// category generates the data items of a category in the block.
+func (g *generator) category(b *Block, cat *CategoryDef) error {
+	tags := make([]string, 0, len(cat.Items))
+	looped := cat.Class != "Set"
+	for _, tag := range cat.Items {
+		item := g.d.Items[tag]
+		if g.d.Canonical(tag) != tag {
+			// The data item has been replaced by another.
+			continue
+		}
+		if len(item.Container) > 0 &&
+			!strings.EqualFold(item.Container, "single") {
+			continue
+		}
+		if item.List == "no" {
+			looped = false
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := g.rows
+	if !looped {
+		rows = 1
+	}
+
+	// Group the links of the data items in the category, such that the
+	// children in a group take their values from the same row of their
+	// parents.
+	var groups [][]Link
+	var inner []Link
+	index := make(map[string]int, 10)
+	linked := make(map[string]bool, 10)
+	for _, link := range g.d.Links {
+		linked[link.Parent] = true
+		child := g.d.Items[link.Child]
+		if child == nil || child.Category != cat.Name {
+			continue
+		}
+		linked[link.Child] = true
+		if parent := g.d.Items[link.Parent]; parent != nil &&
+			parent.Category == cat.Name {
+
+			inner = append(inner, link)
+			continue
+		}
+		if len(g.values[link.Parent]) == 0 {
+			continue
+		}
+		key := link.Group
+		if len(key) == 0 {
+			key = link.Child + "\x00" + link.Parent
+		}
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], link)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []Link{link})
+	}
+	keys := make(map[string]bool, len(cat.Keys))
+	for _, key := range cat.Keys {
+		keys[key] = true
+	}
+
+	columns := make(map[string][]string, len(tags))
+	seen := make(map[string]bool, rows)
+	for row := 0; row < rows; row++ {
+		var vals map[string]string
+		for attempt := 0; ; attempt++ {
+			if attempt == 20 {
+				// There are not enough distinct keys for more rows.
+				rows = row
+				break
+			}
+			var err error
+			vals, err = g.row(tags, groups, inner, keys, linked)
+			if err != nil {
+				return err
+			}
+			rowKey := make([]string, len(cat.Keys))
+			for i, key := range cat.Keys {
+				rowKey[i] = vals[key]
+			}
+			if k := strings.Join(rowKey, "\x00"); len(cat.Keys) == 0 ||
+				!seen[k] {
+				seen[k] = true
+				break
+			}
+		}
+		if row == rows {
+			break
+		}
+		for _, tag := range tags {
+			columns[tag] = append(columns[tag], vals[tag])
+		}
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	var lp *Loop
+	if looped {
+		lp = &Loop{
+			Columns: make(map[string]int, len(tags)),
+			Values:  make([]ValueLoop, len(tags)),
+		}
+	}
+	for i, tag := range tags {
+		g.values[tag] = columns[tag]
+		kind := itemKind(g.d.Items[tag])
+		if lp == nil {
+			b.Items[tag] = typedText(kind, columns[tag][0])
+		} else {
+			lp.Columns[tag] = i
+			lp.Values[i] = typedTexts(kind, columns[tag])
+			b.Loops[tag] = lp
+		}
+		b.order = append(b.order, tag)
+	}
+	return nil
+}
+
+// row generates the values of a single row of a category. The children in
+// each group of links take their values from a random row of their parents,
+// while children whose parents are in the same category take their values
+// from the same row.
+func (g *generator) row(tags []string, groups [][]Link, inner []Link,
+	keys, linked map[string]bool) (map[string]string, error) {
+
+	vals := make(map[string]string, len(tags))
+	for _, group := range groups {
+		row := g.rand.Intn(len(g.values[group[0].Parent]))
+		for _, link := range group {
+			parent := g.values[link.Parent]
+			if row < len(parent) {
+				vals[link.Child] = parent[row]
+			}
+		}
+	}
+	for _, tag := range tags {
+		if _, ok := vals[tag]; ok {
+			continue
+		}
+		item := g.d.Items[tag]
+		if !item.Mandatory && !keys[tag] && !linked[tag] &&
+			g.rand.Intn(10) == 0 {
+
+			vals[tag] = []string{".", "?"}[g.rand.Intn(2)]
+			continue
+		}
+		s, err := g.value(item)
+		if err != nil {
+			return nil, err
+		}
+		vals[tag] = s
+	}
+	for range inner {
+		for _, link := range inner {
+			if s, ok := vals[link.Parent]; ok {
+				vals[link.Child] = s
+			}
+		}
+	}
+	return vals, nil
+}
+
+// value returns a random valid value of a data item. The value of a parent
+// must also be a valid value of each of its children, so candidates are
+// taken from the definitions of its children too.
+func (g *generator) value(item *ItemDef) (string, error) {
+	defs := []*ItemDef{item}
+	for _, child := range g.d.Children(item.Name) {
+		if def := g.d.Items[child]; def != nil {
+			defs = append(defs, def)
+		}
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		s, err := g.candidate(defs[g.rand.Intn(len(defs))])
+		if err != nil {
+			return "", err
+		}
+		valid := true
+		for _, def := range defs {
+			valid = valid && g.valid(def, s)
+		}
+		if valid {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("Could not generate a valid value for the data "+
+		"item '%s'.", item.Name)
+}
+
+// candidate returns a random value for a data item, which may not be valid.
+func (g *generator) candidate(item *ItemDef) (string, error) {
+	kind := itemKind(item)
+	switch {
+	case len(item.Enumeration) > 0:
+		return item.Enumeration[g.rand.Intn(len(item.Enumeration))], nil
+	case len(item.Ranges) > 0:
+		r := item.Ranges[g.rand.Intn(len(item.Ranges))]
+		return g.number(kind, r), nil
+	case kind == itemDataString && g.rand.Intn(4) == 0:
+		return quotingCases[g.rand.Intn(len(quotingCases))], nil
+	}
+
+	re, err := g.regexp(item.Type)
+	if err != nil {
+		return "", err
+	}
+	if re != nil {
+		return g.match(re), nil
+	}
+	switch kind {
+	case itemDataInteger:
+		return g.number(kind, Range{HasMin: true, Max: 1000, HasMax: true}),
+			nil
+	case itemDataFloat:
+		return g.number(kind, Range{Min: -1000, HasMin: true,
+			Max: 1000, HasMax: true}), nil
+	}
+	word := make([]byte, 1+g.rand.Intn(8))
+	for i := range word {
+		word[i] = byte('a' + g.rand.Intn(26))
+	}
+	return string(word), nil
+}
+
+// valid returns true if s is a valid value of the data item, which also
+// means that it can be read with the type of the data item.
+func (g *generator) valid(item *ItemDef, s string) bool {
+	if isNullText(s) {
+		return false
+	}
+	v := &validator{}
+	v.validateDictValue(g.d, item, item.Name, 0, s)
+	if len(v.errs) > 0 {
+		return false
+	}
+	switch itemKind(item) {
+	case itemDataInteger:
+		_, err := strconv.Atoi(trimUncertainty(s))
+		return err == nil
+	case itemDataFloat:
+		_, err := strconv.ParseFloat(trimUncertainty(s), 64)
+		return err == nil
+	}
+	return true
+}
+
+// maxGenerateInt bounds the integers generated by number, so that the size
+// of a range of integers always fits in an int.
+const maxGenerateInt = 1e9
+
+// number returns a random number in the range given. Missing bounds are
+// replaced with bounds 100 away from the other bound (or 0). Integers are
+// kept within maxGenerateInt of 0.
+func (g *generator) number(kind itemType, r Range) string {
+	min, max := r.Min, r.Max
+	switch {
+	case !r.HasMin && !r.HasMax:
+		min, max = 0, 100
+	case !r.HasMin:
+		min = max - 100
+	case !r.HasMax:
+		max = min + 100
+	}
+	if kind == itemDataInteger {
+		lo := int(math.Max(-maxGenerateInt, math.Min(min, maxGenerateInt)))
+		hi := int(math.Max(-maxGenerateInt, math.Min(max, maxGenerateInt)))
+		if hi < lo {
+			hi = lo
+		}
+		return strconv.Itoa(lo + g.rand.Intn(hi-lo+1))
+	}
+	f := min + g.rand.Float64()*(max-min)
+	return strconv.FormatFloat(f, 'f', 1+g.rand.Intn(3), 64)
+}
+
+// regexp returns the parsed regular expression of a type, or nil if it has
+// none.
+func (g *generator) regexp(code string) (*syntax.Regexp, error) {
+	if re, ok := g.types[code]; ok {
+		return re, nil
+	}
+	typ := g.d.Types[code]
+	if typ == nil || typ.Regexp == nil {
+		g.types[code] = nil
+		return nil, nil
+	}
+	re, err := syntax.Parse(typ.Regexp.String(), syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse the regular expression of "+
+			"the type '%s': %s", code, err)
+	}
+	re = re.Simplify()
+	g.types[code] = re
+	return re, nil
+}
+
+// match returns a random string matching the regular expression given.
+// Characters are chosen from printable ASCII when possible, and unbounded
+// repetitions are repeated at most 3 more times than their minimum.
+func (g *generator) match(re *syntax.Regexp) string {
+	var buf []rune
+	var walk func(re *syntax.Regexp)
+	repeat := func(re *syntax.Regexp, min, max int) {
+		if max < 0 {
+			max = min + 3
+		}
+		for n := min + g.rand.Intn(max-min+1); n > 0; n-- {
+			walk(re.Sub[0])
+		}
+	}
+	walk = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			for _, r := range re.Rune {
+				if re.Flags&syntax.FoldCase != 0 && g.rand.Intn(2) == 0 {
+					r = swapCase(r)
+				}
+				buf = append(buf, r)
+			}
+		case syntax.OpCharClass:
+			buf = append(buf, g.classRune(re.Rune))
+		case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+			buf = append(buf, rune(' '+1+g.rand.Intn('~'-' ')))
+		case syntax.OpCapture:
+			walk(re.Sub[0])
+		case syntax.OpStar:
+			repeat(re, 0, -1)
+		case syntax.OpPlus:
+			repeat(re, 1, -1)
+		case syntax.OpQuest:
+			repeat(re, 0, 1)
+		case syntax.OpRepeat:
+			repeat(re, re.Min, re.Max)
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				walk(sub)
+			}
+		case syntax.OpAlternate:
+			walk(re.Sub[g.rand.Intn(len(re.Sub))])
+		}
+	}
+	walk(re)
+	return string(buf)
+}
+
+// classRune returns a random character in a character class, given as pairs
+// of inclusive ranges. Printable ASCII characters are preferred.
+func (g *generator) classRune(ranges []rune) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1] && r <= '~'; r++ {
+			if r >= ' ' {
+				printable = append(printable, r)
+			}
+		}
+	}
+	if len(printable) > 0 {
+		return printable[g.rand.Intn(len(printable))]
+	}
+	if len(ranges) < 2 {
+		return 'x'
+	}
+	i := 2 * g.rand.Intn(len(ranges)/2)
+	return ranges[i] + rune(g.rand.Int63n(int64(ranges[i+1]-ranges[i]+1)))
+}
+
+// swapCase returns an ASCII letter in the other case.
+func swapCase(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return r - 'a' + 'A'
+	case r >= 'A' && r <= 'Z':
+		return r - 'A' + 'a'
+	}
+	return r
+}
+
+// typedText returns a value read from text with the kind of type given, as
+// with ReadWith. Omitted and missing values are strings.
+func typedText(kind itemType, s string) Value {
+	if isNullText(s) {
+		return cifString(s)
+	}
+	switch kind {
+	case itemDataInteger:
+		n, _ := strconv.Atoi(trimUncertainty(s))
+		return cifInt{n: n, text: s}
+	case itemDataFloat:
+		f, _ := strconv.ParseFloat(trimUncertainty(s), 64)
+		return cifFloat{f: f, text: s}
+	}
+	return cifString(s)
+}
+
+// typedTexts returns a column of values read from texts with the kind of
+// type given, as with ReadWith. Omitted and missing values are 0.
+func typedTexts(kind itemType, texts []string) ValueLoop {
+	switch kind {
+	case itemDataInteger:
+		nums := make([]int, len(texts))
+		for i, s := range texts {
+			if !isNullText(s) {
+				nums[i], _ = strconv.Atoi(trimUncertainty(s))
+			}
+		}
+		return cifInts{ints: nums, texts: texts}
+	case itemDataFloat:
+		nums := make([]float64, len(texts))
+		for i, s := range texts {
+			if !isNullText(s) {
+				nums[i], _ = strconv.ParseFloat(trimUncertainty(s), 64)
+			}
+		}
+		return cifFloats{floats: nums, texts: texts}
+	}
+	return cifStrings(texts)
+}
@@ -0,0 +1,362 @@
+package cif
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// inferTypes are the types given to inferred data items, from the most
+// specific to the most general. Each type matches every value of the types
+// before it. The constructs of the string types ("code", "line" and "text")
+// are the same as in mmcif_pdbx.dic.
+var inferTypes = []*TypeDef{
+	{
+		Code:      "int",
+		Primitive: "numb",
+		Construct: `[+-]?[0-9]+([(][0-9]+[)])?`,
+		Detail:    "integers, with an optional standard uncertainty",
+	},
+	{
+		Code:      "float",
+		Primitive: "numb",
+		Construct: `[+-]?([0-9]+[.]?[0-9]*|[.][0-9]*)([eE][+-]?[0-9]*)?` +
+			`([(][0-9]+[)])?`,
+		Detail: "floating point numbers, with an optional standard " +
+			"uncertainty",
+	},
+	{
+		Code:      "code",
+		Primitive: "char",
+		Construct: `[_,.;:"&<>()/\{}'` + "`" + `~!@#$%A-Za-z0-9*|+-]*`,
+		Detail:    "code item types/single words",
+	},
+	{
+		Code:      "line",
+		Primitive: "char",
+		Construct: `[][ \t_(),.;:"&<>/\{}'` + "`" +
+			`~!@#$%?+=*A-Za-z0-9|^-]*`,
+		Detail: "char item types/multi-word items",
+	},
+	{
+		Code:      "text",
+		Primitive: "char",
+		Construct: `[][ \n\t()_,.;:"&<>/\{}'` + "`" +
+			`~!@#$%?+=*A-Za-z0-9|^-]*`,
+		Detail: "text item types/multi-line text",
+	},
+}
+
+// inferRegexps are the compiled constructs of inferTypes.
+var inferRegexps = func() []*regexp.Regexp {
+	res := make([]*regexp.Regexp, len(inferTypes))
+	for i, typ := range inferTypes {
+		res[i] = regexp.MustCompile("^(?:" + typ.Construct + ")$")
+	}
+	return res
+}()
+
+// Inferrer infers a draft dictionary from the data items in CIF data. Data
+// is added with Add (one CIF at a time, so that a large corpus of CIF files
+// never needs to be in memory at once), and the dictionary is built with
+// Dictionary.
+type Inferrer struct {
+	// MaxEnumeration is the largest number of distinct values that a data
+	// item with a "code" type may have for its values to be inferred as an
+	// enumeration. NewInferrer sets it to 10.
+	MaxEnumeration int
+
+	blocks int
+	tags   map[string]*tagStats
+	cats   map[string]*catStats
+}
+
+// tagStats contains what has been observed about the values of a data tag.
+type tagStats struct {
+	blocks, looped, scalar int  // blocks with the tag (in a table or not)
+	values, missing        int  // values, and values that are missing
+	omitted                int  // values that are omitted
+	typ                    int  // index of its type in inferTypes
+	hasRange               bool // true when min and max are set
+	min, max               float64
+
+	// distinct contains the distinct values of the tag, or is nil if there
+	// are more than can be enumerated.
+	distinct map[string]bool
+
+	// unique is true if the tag never has the same value twice in a table,
+	// and is never omitted or missing.
+	unique bool
+}
+
+// catStats contains what has been observed about the data tags of a
+// category.
+type catStats struct {
+	blocks int             // blocks with the category
+	tags   map[string]bool // tags in the category
+	first  []string        // tags of the category in the order first seen
+}
+
+// NewInferrer returns a new Inferrer without any data.
+func NewInferrer() *Inferrer {
+	return &Inferrer{
+		MaxEnumeration: 10,
+		tags:           make(map[string]*tagStats, 100),
+		cats:           make(map[string]*catStats, 20),
+	}
+}
+
+// Add adds the data items of every data block and save frame in a CIF.
+func (inf *Inferrer) Add(cif *CIF) {
+	names := make([]string, 0, len(cif.Blocks))
+	for name := range cif.Blocks {
+		names = append(names, name)
+	}
+	for _, name := range ordered(cif.order, names, lessString) {
+		b := cif.Blocks[name]
+		inf.addBlock(&b.Block)
+		for _, frame := range orderedFrames(b) {
+			inf.addBlock(&frame.Block)
+		}
+	}
+}
+
+// addBlock adds the data items of a single data block or save frame.
+func (inf *Inferrer) addBlock(b *Block) {
+	inf.blocks++
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+	tags = ordered(b.order, tags, lessTag)
+
+	cats := make(map[string]bool, 10)
+	for _, tag := range tags {
+		cat := inf.cats[tagCategory(tag)]
+		if cat == nil {
+			cat = &catStats{tags: make(map[string]bool, 10)}
+			inf.cats[tagCategory(tag)] = cat
+		}
+		if !cats[tagCategory(tag)] {
+			cats[tagCategory(tag)] = true
+			cat.blocks++
+		}
+		if !cat.tags[tag] {
+			cat.tags[tag] = true
+			cat.first = append(cat.first, tag)
+		}
+
+		st := inf.tags[tag]
+		if st == nil {
+			st = &tagStats{
+				distinct: make(map[string]bool, 10),
+				unique:   true,
+			}
+			inf.tags[tag] = st
+		}
+		st.blocks++
+		if _, ok := b.Loops[tag]; ok {
+			st.looped++
+		} else {
+			st.scalar++
+		}
+		seen := make(map[string]bool, 10)
+		for _, s := range dictColumn(b, tag) {
+			inf.addValue(st, s)
+			if isNullText(s) || seen[s] {
+				st.unique = false
+			}
+			seen[s] = true
+		}
+	}
+}
+
+// addValue adds a single value of a data tag.
+func (inf *Inferrer) addValue(st *tagStats, s string) {
+	st.values++
+	switch s {
+	case "?":
+		st.missing++
+		return
+	case ".":
+		st.omitted++
+		return
+	}
+	for st.typ < len(inferTypes)-1 && !inferRegexps[st.typ].MatchString(s) {
+		st.typ++
+	}
+	if st.typ <= 1 {
+		if f, err := strconv.ParseFloat(trimUncertainty(s), 64); err == nil {
+			if !st.hasRange || f < st.min {
+				st.min = f
+			}
+			if !st.hasRange || f > st.max {
+				st.max = f
+			}
+			st.hasRange = true
+		}
+	}
+	if st.distinct != nil && !st.distinct[s] {
+		if len(st.distinct) >= inf.MaxEnumeration {
+			st.distinct = nil
+			return
+		}
+		st.distinct[s] = true
+	}
+}
+
+// Dictionary returns a draft dictionary describing the data items added so
+// far. Its title is the title given. Every data item is in the category
+// named by the part of its data tag before the first '.' (which is the
+// entire data tag when it has no '.'). For every data item:
+//
+// Its type is the most specific of "int", "float", "code", "line" and
+// "text" that matches all of its values (or "text" if none do), where the
+// numeric types are based on the same rules the reader uses to read numbers
+// (but also permit a standard uncertainty in parentheses).
+//
+// Data items with a numeric type have a range that includes every value
+// seen. Data items with a "code" type have an enumeration of their values,
+// if there are no more than MaxEnumeration distinct values and each value
+// was seen at least twice on average.
+//
+// Its looping rule (see ItemDef.List) is "yes" if it was only seen in
+// tables, "no" if it was never seen in a table and "both" otherwise.
+//
+// It is mandatory if it was seen in every data block (or save frame) with
+// its category, and it was never missing ("?").
+//
+// Its description says how often it was seen.
+//
+// A category whose data items were always in tables has a key, which is the
+// first of its data items (by data tag ending in "id", then in the order
+// seen) whose values were never repeated in a table and never omitted or
+// missing, and which is mandatory.
+//
+// Since the inferences are only as good as the data seen, the dictionary
+// should be reviewed (and completed) by hand. It may be written as a DDL2
+// dictionary with Dictionary.DDL2.
+func (inf *Inferrer) Dictionary(title string) *Dictionary {
+	d := &Dictionary{
+		Title:      title,
+		Categories: make(map[string]*CategoryDef, len(inf.cats)),
+		Items:      make(map[string]*ItemDef, len(inf.tags)),
+		Types:      make(map[string]*TypeDef, len(inferTypes)),
+		Units:      make(map[string]string),
+	}
+	for _, typ := range inferTypes {
+		d.addType(&TypeDef{
+			Code:      typ.Code,
+			Primitive: typ.Primitive,
+			Construct: typ.Construct,
+			Detail:    typ.Detail,
+		})
+	}
+
+	for name, cst := range inf.cats {
+		cat := &CategoryDef{
+			Name: name,
+			Description: fmt.Sprintf("Draft definition of a category seen "+
+				"in %d of %s.", cst.blocks, plural(inf.blocks, "data block")),
+		}
+		d.Categories[name] = cat
+
+		looped := true
+		for _, tag := range cst.first {
+			st := inf.tags[tag]
+			item := &ItemDef{
+				Name:        tag,
+				Category:    name,
+				Description: describeStats(st),
+				Mandatory:   st.blocks == cst.blocks && st.missing == 0,
+				Type:        inferTypes[st.typ].Code,
+				List:        "both",
+			}
+			switch {
+			case st.scalar == 0:
+				item.List = "yes"
+			case st.looped == 0:
+				item.List = "no"
+			}
+			looped = looped && item.List == "yes"
+			if st.typ <= 1 && st.hasRange {
+				item.Ranges = []Range{{
+					Min: st.min, Max: st.max, HasMin: true, HasMax: true,
+				}}
+			}
+			nonNull := st.values - st.missing - st.omitted
+			if inferTypes[st.typ].Code == "code" && st.distinct != nil &&
+				len(st.distinct) > 0 && nonNull >= 2*len(st.distinct) {
+
+				for s := range st.distinct {
+					item.Enumeration = append(item.Enumeration, s)
+				}
+				sort.Strings(item.Enumeration)
+			}
+			d.Items[tag] = item
+		}
+		if looped {
+			if key := inferKey(d, inf, cst); len(key) > 0 {
+				cat.Keys = []string{key}
+			}
+		}
+	}
+	d.finish()
+	return d
+}
+
+// inferKey returns the data tag that is the key of a category, or the empty
+// string if none of its data items could be a key.
+func inferKey(d *Dictionary, inf *Inferrer, cst *catStats) string {
+	var candidates []string
+	for _, tag := range cst.first {
+		st := inf.tags[tag]
+		if st.unique && d.Items[tag].Mandatory {
+			candidates = append(candidates, tag)
+		}
+	}
+	for _, tag := range candidates {
+		if strings.HasSuffix(tag, "id") {
+			return tag
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// describeStats returns the description of an inferred data item.
+func describeStats(st *tagStats) string {
+	var where string
+	switch {
+	case st.scalar == 0:
+		where = "always in a table"
+	case st.looped == 0:
+		where = "never in a table"
+	default:
+		where = fmt.Sprintf("in a table in %d of them", st.looped)
+	}
+	desc := fmt.Sprintf("Draft definition inferred from %s in %s, %s.",
+		plural(st.values, "value"), plural(st.blocks, "data block"), where)
+	if st.missing > 0 {
+		desc += fmt.Sprintf(" Missing values: %d.", st.missing)
+	}
+	if st.omitted > 0 {
+		desc += fmt.Sprintf(" Omitted values: %d.", st.omitted)
+	}
+	return desc
+}
+
+// plural returns n followed by a noun, which is made plural if n is not 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,127 @@
+package cif
+
+import "strings"
+
+// CheckLinks checks the parent/child relationships declared in a dictionary
+// (see Dictionary.Links) between the data items of a block. Every value of a
+// child data item must also be a value of its parent. Links in the same
+// group are checked together, such that the values of the children in each
+// row must match the values of the parents in a single row.
+//
+// Omitted (".") and missing ("?") values of children are not checked, and
+// neither are links whose children are not in the block. When the parent of
+// a child in the block is not in the block, a single problem is reported for
+// the link. Otherwise, a problem is reported for every row (starting at 1,
+// or 0 for a data item not in a table) with a dangling reference.
+//
+// If there are no problems, then nil is returned. Otherwise, the error
+// returned has type ValidationErrors, which lists every problem in a
+// deterministic order.
+func CheckLinks(b *Block, d *Dictionary) error {
+	v := &validator{block: b.Name}
+	groups := make(map[string][]Link, len(d.Links))
+	keys := make([]string, 0, len(d.Links))
+	for _, link := range d.Links {
+		if link.Child == link.Parent || dictColumn(b, link.Child) == nil {
+			continue
+		}
+		key := link.Group
+		if len(key) == 0 {
+			key = link.Child + "\x00" + link.Parent
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], link)
+	}
+	for _, key := range keys {
+		v.checkLinks(b, groups[key])
+	}
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// checkLinks checks a group of links that must hold together. Every child in
+// the group is in the block.
+func (v *validator) checkLinks(b *Block, links []Link) {
+	children := make([]string, len(links))
+	parents := make([]string, len(links))
+	childCols := make([][]string, len(links))
+	parentCols := make([][]string, len(links))
+	rows, parentRows := 0, 0
+	for i, link := range links {
+		children[i], parents[i] = link.Child, link.Parent
+		childCols[i] = dictColumn(b, link.Child)
+		parentCols[i] = dictColumn(b, link.Parent)
+		if parentCols[i] == nil {
+			v.errf(link.Child, 0, "The parent data item '%s' is not in the "+
+				"block, so no value has a matching parent.", link.Parent)
+			return
+		}
+		if len(childCols[i]) > rows {
+			rows = len(childCols[i])
+		}
+		if len(parentCols[i]) > parentRows {
+			parentRows = len(parentCols[i])
+		}
+	}
+
+	keys := make(map[string]bool, parentRows)
+	for row := 0; row < parentRows; row++ {
+		keys[strings.Join(rowValues(parentCols, row), "\x00")] = true
+	}
+
+	inLoop := false
+	for _, child := range children {
+		if _, ok := b.Loops[child]; ok {
+			inLoop = true
+		}
+	}
+	for row := 0; row < rows; row++ {
+		vals := rowValues(childCols, row)
+		if hasNull(vals) || keys[strings.Join(vals, "\x00")] {
+			continue
+		}
+		n := 0
+		if inLoop {
+			n = row + 1
+		}
+		if len(links) == 1 {
+			v.errf(children[0], n, "The value '%s' has no matching value "+
+				"of the parent data item '%s'.", vals[0], parents[0])
+			continue
+		}
+		v.errf(children[0], n, "The values (%s) of (%s) have no matching "+
+			"row of the parent data items (%s).", strings.Join(vals, ", "),
+			strings.Join(children, ", "), strings.Join(parents, ", "))
+	}
+}
+
+// rowValues returns the values in a row of the columns given. A column with
+// a single value (from a data item not in a table) applies to every row.
+func rowValues(columns [][]string, row int) []string {
+	vals := make([]string, len(columns))
+	for i, col := range columns {
+		switch {
+		case row < len(col):
+			vals[i] = col[row]
+		case len(col) == 1:
+			vals[i] = col[0]
+		default:
+			vals[i] = "?"
+		}
+	}
+	return vals
+}
+
+// hasNull returns true if any of the values is omitted or missing.
+func hasNull(vals []string) bool {
+	for _, s := range vals {
+		if isNullText(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1412 @@
+package cif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// cifDDL2 is a small DDL2 dictionary in the style of mmcif_pdbx.dic.
+var cifDDL2 = `data_test.dic
+_dictionary.title   test.dic
+_dictionary.version 1.0
+
+save_atom_site
+    _category.description    'Data items describing atom sites.'
+    _category.id             atom_site
+    _category.mandatory_code no
+    loop_
+    _category_key.name       '_atom_site.id'
+    loop_
+    _category_group.id       'inclusive_group'
+                             'atom_group'
+save_
+
+save__atom_site.id
+    _item_description.description
+;   The identifier of the atom site.
+;
+    loop_
+    _item.name
+    _item.category_id
+    _item.mandatory_code
+         '_atom_site.id'               atom_site          yes
+         '_atom_site_anisotrop.id'     atom_site_anisotrop yes
+    _item_type.code                    code
+    loop_
+    _item_linked.child_name
+    _item_linked.parent_name
+         '_atom_site_anisotrop.id'     '_atom_site.id'
+save_
+
+save__atom_site.B_iso
+    _item.name                  '_atom_site.B_iso'
+    _item.category_id           atom_site
+    _item.mandatory_code        no
+    _item_type.code             float
+    _item_units.code            angstroms_squared
+    _item_aliases.alias_name    '_atom_site_B_iso_or_equiv'
+    loop_
+    _item_range.maximum
+    _item_range.minimum
+         .    0.0
+         0.0  0.0
+save_
+
+save__atom_site.type
+    _item.name                  '_atom_site.type'
+    _item.category_id           atom_site
+    _item.mandatory_code        no
+    _item_type.code             ucode
+    _item_default.value         ATOM
+    loop_
+    _item_enumeration.value
+         ATOM
+         HETATM
+save_
+
+save_atom_site_anisotrop
+    _category.id             atom_site_anisotrop
+    _category.mandatory_code no
+    _category_key.name       '_atom_site_anisotrop.id'
+save_
+
+save__atom_site_anisotrop.id
+    _item.name                  '_atom_site_anisotrop.id'
+    _item.category_id           atom_site_anisotrop
+    _item.mandatory_code        yes
+    _item_type.code             int
+save_
+
+loop_
+_item_type_list.code
+_item_type_list.primitive_code
+_item_type_list.construct
+_item_type_list.detail
+  code  char  '[_,.;:"&<>()/\{}'` + "`" + `~!@#$%A-Za-z0-9*|+-]*'
+;  code item types/single words
+;
+  ucode uchar '[_,.;:"&<>()/\{}'` + "`" + `~!@#$%A-Za-z0-9*|+-]*' .
+  int   numb  '[+-]?[0-9]+' .
+  float numb
+  '-?(([0-9]+)[.]?|([0-9]*[.][0-9]+))([(][0-9]+[)])?([eE][+-]?[0-9]+)?' .
+  bad   char  '[a-' .
+
+loop_
+_item_units_list.code
+_item_units_list.detail
+  angstroms_squared 'angstroms squared'
+`
+
+func TestLoadDDL2(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(cif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Title != "test.dic" || d.Version != "1.0" {
+		t.Fatalf("Wrong title or version: '%s' '%s'.", d.Title, d.Version)
+	}
+
+	cat := d.Category("ATOM_SITE")
+	if cat == nil {
+		t.Fatalf("Category 'atom_site' is missing.")
+	}
+	want := &CategoryDef{
+		Name:        "atom_site",
+		Description: "Data items describing atom sites.",
+		Keys:        []string{"atom_site.id"},
+		Groups:      []string{"inclusive_group", "atom_group"},
+		Items: []string{
+			"atom_site.b_iso", "atom_site.id", "atom_site.type",
+		},
+	}
+	if !reflect.DeepEqual(cat, want) {
+		t.Fatalf("Category should be\n%#v\nbut is\n%#v", want, cat)
+	}
+
+	// The data item's own save frame takes precedence over its parent's.
+	item := d.Item("_atom_site_anisotrop.id")
+	if item == nil || item.Type != "int" || !item.Mandatory ||
+		item.Category != "atom_site_anisotrop" {
+		t.Fatalf("Wrong definition of '_atom_site_anisotrop.id': %#v", item)
+	}
+	if item := d.Item("atom_site.id"); item.Description !=
+		"The identifier of the atom site." {
+		t.Fatalf("Wrong description: '%s'.", item.Description)
+	}
+
+	item = d.Item("_atom_site.type")
+	if !reflect.DeepEqual(item.Enumeration, []string{"ATOM", "HETATM"}) {
+		t.Fatalf("Wrong enumeration: %v", item.Enumeration)
+	}
+	if item.Default != "ATOM" {
+		t.Fatalf("Wrong default: '%s'.", item.Default)
+	}
+
+	item = d.Item("_atom_site.b_iso")
+	if item.Units != "angstroms_squared" ||
+		d.Units[item.Units] != "angstroms squared" {
+		t.Fatalf("Wrong units: '%s'.", item.Units)
+	}
+	if len(item.Ranges) != 2 {
+		t.Fatalf("Wrong ranges: %v", item.Ranges)
+	}
+	inRange := func(f float64) bool {
+		for _, r := range item.Ranges {
+			if r.Contains(f) {
+				return true
+			}
+		}
+		return false
+	}
+	for f, want := range map[float64]bool{-1: false, 0: true, 50.5: true} {
+		if got := inRange(f); got != want {
+			t.Fatalf("%v should be in range (%v) but is not (%v).",
+				f, want, got)
+		}
+	}
+
+	typ := d.Type("atom_site.b_iso")
+	if typ == nil || typ.Primitive != "numb" {
+		t.Fatalf("Wrong type: %#v", typ)
+	}
+	for s, want := range map[string]bool{
+		"1.5": true, "-3": true, "1.5(3)": true, "1e-3": true, "abc": false,
+	} {
+		if got := typ.Match(s); got != want {
+			t.Fatalf("Match of '%s' should be %v but is %v.", s, want, got)
+		}
+	}
+	if typ := d.Types["code"]; typ.Detail != "code item types/single words" {
+		t.Fatalf("Wrong detail: '%s'.", typ.Detail)
+	}
+	if typ := d.Types["bad"]; typ.Regexp != nil || !typ.Match("anything") {
+		t.Fatalf("An invalid construct should match anything.")
+	}
+
+	links := []Link{{Child: "atom_site_anisotrop.id", Parent: "atom_site.id"}}
+	if !reflect.DeepEqual(d.Links, links) {
+		t.Fatalf("Links should be %v but are %v.", links, d.Links)
+	}
+	parents := d.Parents("_atom_site_anisotrop.id")
+	if !reflect.DeepEqual(parents, []string{"atom_site.id"}) {
+		t.Fatalf("Wrong parents: %v", parents)
+	}
+	children := d.Children("_atom_site.id")
+	if !reflect.DeepEqual(children, []string{"atom_site_anisotrop.id"}) {
+		t.Fatalf("Wrong children: %v", children)
+	}
+
+	if _, err := LoadDDL2(&CIF{}); err == nil {
+		t.Fatalf("Loading an empty dictionary should fail.")
+	}
+}
+
+func TestValidateDict(t *testing.T) {
+	dcif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(dcif)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `data_test
+_atom_site_anisotrop.id 1
+_atom_site.unknown x
+loop_
+_atom_site.id
+_atom_site.type
+_atom_site.B_iso
+a1 ATOM    0
+a2 hetatm  1.5(2)
+a1 ION     -1
+a3 HETATM  ?
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := problems(t, Validate(&cif.Blocks["test"].Block, d))
+	got := make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	want := []string{
+		"CIF validation error (block 'test', tag 'atom_site.unknown'): " +
+			"The data tag is not defined in the dictionary.",
+		"CIF validation error (block 'test', tag 'atom_site.type', " +
+			"row 3): The value 'ION' is not one of the permitted values: " +
+			"ATOM, HETATM.",
+		"CIF validation error (block 'test', tag 'atom_site.b_iso', " +
+			"row 3): The value '-1' is not in any of the permitted ranges: " +
+			"0:., 0:0.",
+		"CIF validation error (block 'test', tag 'atom_site.id', row 3): " +
+			"The key (atom_site.id) = (a1) is the same as the key of row 1.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	data = `data_test
+loop_
+_atom_site_anisotrop.id
+1
+x
+?
+`
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = problems(t, Validate(&cif.Blocks["test"].Block, d))
+	got = make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	want = []string{
+		"CIF validation error (block 'test', tag 'atom_site_anisotrop.id', " +
+			"row 2): The value 'x' does not match the type 'int'.",
+		"CIF validation error (block 'test', tag 'atom_site_anisotrop.id', " +
+			"row 3): The mandatory data item has a missing value.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// cifDDL1 is a small DDL1 dictionary in the style of cif_core.dic.
+var cifDDL1 = `data_on_this_dictionary
+    _dictionary_name            test_core.dic
+    _dictionary_version         2.4
+
+data_atom_site_[]
+    _name                      '_atom_site_[]'
+    _category                    category_overview
+    _type                        null
+    _definition
+;   Data items describing atom sites.
+;
+
+data_atom_site_label
+    _name                      '_atom_site_label'
+    _category                    atom_site
+    _type                        char
+    _list                        yes
+    _list_mandatory              yes
+    _list_reference            '_atom_site_label'
+    _definition                'The label of the atom site.'
+
+data_atom_site_occupancy
+    _name                      '_atom_site_occupancy'
+    _category                    atom_site
+    _type                        numb
+    _type_conditions             esd
+    _list                        yes
+    _list_reference            '_atom_site_label'
+    _enumeration_range           0.0:1.0
+    _enumeration_default         1.0
+
+data_cell_length_
+    loop_ _name                '_cell_length_a'
+                               '_cell_length_b'
+                               '_cell_length_c'
+    _category                    cell
+    _type                        numb
+    _type_conditions             esd
+    _list                        no
+    _enumeration_range           0.0:
+    _units                       A
+    _units_detail              'angstroms'
+
+data_symmetry_cell_setting
+    _name                      '_symmetry_cell_setting'
+    _category                    symmetry
+    _type                        char
+    _list                        no
+    loop_ _enumeration           triclinic
+                                 monoclinic
+
+data_symmetry_space_group_name_H-M
+    _name                      '_symmetry_space_group_name_H-M'
+    _category                    symmetry
+    _type                        char
+    _list                        no
+    _related_item              '_space_group_name_H-M_alt'
+    _related_function            replace
+
+data_space_group_name_H-M_alt
+    _name                      '_space_group_name_H-M_alt'
+    _category                    space_group
+    _type                        char
+    _list                        no
+`
+
+func TestLoadDDL1(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifDDL1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL1(cif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Title != "test_core.dic" || d.Version != "2.4" {
+		t.Fatalf("Wrong title or version: '%s' '%s'.", d.Title, d.Version)
+	}
+
+	cat := d.Category("atom_site")
+	want := &CategoryDef{
+		Name:        "atom_site",
+		Description: "Data items describing atom sites.",
+		Keys:        []string{"atom_site_label"},
+		Items:       []string{"atom_site_label", "atom_site_occupancy"},
+	}
+	if !reflect.DeepEqual(cat, want) {
+		t.Fatalf("Category should be\n%#v\nbut is\n%#v", want, cat)
+	}
+	cat = d.Category("cell")
+	items := []string{"cell_length_a", "cell_length_b", "cell_length_c"}
+	if cat == nil || !reflect.DeepEqual(cat.Items, items) {
+		t.Fatalf("Wrong category 'cell': %#v", cat)
+	}
+
+	item := d.Item("_cell_length_b")
+	if item == nil || item.Type != "numb" || item.List != "no" ||
+		item.Units != "a" || d.Units["a"] != "angstroms" {
+		t.Fatalf("Wrong definition of '_cell_length_b': %#v", item)
+	}
+	if len(item.Ranges) != 1 || !item.Ranges[0].Contains(0) ||
+		item.Ranges[0].Contains(-0.1) {
+		t.Fatalf("Wrong ranges: %v", item.Ranges)
+	}
+	if !d.Type("cell_length_b").Match("5.4(3)") {
+		t.Fatalf("A number with an uncertainty should be a number.")
+	}
+	if item := d.Item("atom_site_label"); !item.Mandatory {
+		t.Fatalf("'atom_site_label' should be mandatory.")
+	}
+
+	data := `data_test
+_cell_length_a 5.4(3)
+_cell_length_b -1
+_cell_length_c abc
+_symmetry_cell_setting cubic
+loop_
+_atom_site_occupancy
+_atom_site_label
+1.0 C1
+1.5 C2
+0.5 C1
+`
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := problems(t, Validate(&cif.Blocks["test"].Block, d))
+	got := make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	wantErrs := []string{
+		"CIF validation error (block 'test', tag 'cell_length_b'): " +
+			"The value '-1' is not in any of the permitted ranges: 0:..",
+		"CIF validation error (block 'test', tag 'cell_length_c'): " +
+			"The value 'abc' does not match the type 'numb'.",
+		"CIF validation error (block 'test', tag 'symmetry_cell_setting'): " +
+			"The value 'cubic' is not one of the permitted values: " +
+			"triclinic, monoclinic.",
+		"CIF validation error (block 'test', tag 'atom_site_occupancy', " +
+			"row 2): The value '1.5' is not in any of the permitted " +
+			"ranges: 0:1.",
+		"CIF validation error (block 'test', tag 'atom_site_label', " +
+			"row 3): The key (atom_site_label) = (C1) is the same as the " +
+			"key of row 1.",
+	}
+	if !reflect.DeepEqual(got, wantErrs) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(wantErrs, "\n"), strings.Join(got, "\n"))
+	}
+
+	data = `data_test
+_atom_site_label C1
+loop_
+_symmetry_cell_setting
+triclinic
+`
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = problems(t, Validate(&cif.Blocks["test"].Block, d))
+	got = make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	wantErrs = []string{
+		"CIF validation error (block 'test', tag 'atom_site_label'): " +
+			"The data item must be in a table.",
+		"CIF validation error (block 'test', tag 'symmetry_cell_setting'): " +
+			"The data item must not be in a table.",
+	}
+	if !reflect.DeepEqual(got, wantErrs) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(wantErrs, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// cifDDLm is a small DDLm dictionary in the style of cif_core.dic version 3.
+// It imports definitions from the files in ddlmFiles.
+var cifDDLm = `#\#CIF_2.0
+data_TEST_DIC
+    _dictionary.title            TEST_DIC
+    _dictionary.version          3.0.0
+
+save_TEST_HEAD
+    _definition.id               TEST_HEAD
+    _definition.scope            Category
+    _definition.class            Head
+    _name.category_id            TEST_DIC
+    _name.object_id              TEST_HEAD
+save_
+
+save_CELL
+    _definition.id               CELL
+    _definition.scope            Category
+    _definition.class            Set
+    _name.category_id            TEST_HEAD
+    _name.object_id              CELL
+    _description.text
+;
+    Data items describing the unit cell.
+;
+save_
+
+save_cell.length_a
+    _definition.id               '_cell.length_a'
+    _name.category_id            cell
+    _name.object_id              length_a
+    _alias.definition_id         '_cell_length_a'
+    _import.get   [{'file':'templ_attr.cif' 'save':'cell_length'}]
+save_
+
+save_cell.setting
+    _definition.id               '_cell.setting'
+    _name.category_id            cell
+    _name.object_id              setting
+    _type.contents               Code
+    _enumeration.default         triclinic
+    loop_
+      _enumeration_set.state
+         triclinic
+         monoclinic
+save_
+
+save_cell.vector
+    _definition.id               '_cell.vector'
+    _name.category_id            cell
+    _name.object_id              vector
+    _type.container              Matrix
+    _type.contents               Real
+save_
+
+save_ATOM
+    _definition.id               ATOM
+    _definition.scope            Category
+    _definition.class            Head
+    _name.category_id            TEST_HEAD
+    _name.object_id              ATOM
+    _import.get   [{"file":"atom.dic" "mode":"Full"}]
+save_
+`
+
+// ddlmFiles are the files imported by cifDDLm.
+var ddlmFiles = map[string]string{
+	"templ_attr.cif": `#\#CIF_2.0
+data_TEMPL_ATTR
+save_cell_length
+    _type.purpose                Measurand
+    _type.container              Single
+    _type.contents               Real
+    _enumeration.range           1.0:
+    _units.code                  angstroms
+save_
+`,
+	"atom.dic": `#\#CIF_2.0
+data_ATOM_DIC
+    _dictionary.title            ATOM_DIC
+save_ATOM_HEAD
+    _definition.id               ATOM_HEAD
+    _definition.scope            Category
+    _definition.class            Head
+    _name.category_id            ATOM_DIC
+    _name.object_id              ATOM_HEAD
+save_
+
+save_ATOM_SITE
+    _definition.id               ATOM_SITE
+    _definition.scope            Category
+    _definition.class            Loop
+    _name.category_id            ATOM_HEAD
+    _name.object_id              ATOM_SITE
+    _category_key.name           '_atom_site.label'
+save_
+
+save_atom_site.label
+    _definition.id               '_atom_site.label'
+    _name.category_id            atom_site
+    _name.object_id              label
+    _type.contents               Code
+save_
+
+save_atom_site.cell
+    _definition.id               '_atom_site.cell'
+    _name.category_id            atom_site
+    _name.object_id              cell
+    _name.linked_item_id         '_cell.setting'
+    _type.contents               Code
+save_
+`,
+}
+
+func TestLoadDDLm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cif-ddlm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range ddlmFiles {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cif, err := Read(strings.NewReader(cifDDLm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDLm(cif, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Title != "TEST_DIC" || d.Version != "3.0.0" {
+		t.Fatalf("Wrong title or version: '%s' '%s'.", d.Title, d.Version)
+	}
+
+	// Imported in "Contents" mode.
+	item := d.Item("_cell.length_a")
+	if item == nil || item.Type != "real" || item.Container != "Single" ||
+		item.Purpose != "Measurand" || item.Units != "angstroms" ||
+		len(item.Ranges) != 1 || item.Ranges[0].Contains(0.5) {
+		t.Fatalf("Wrong definition of '_cell.length_a': %#v", item)
+	}
+	if got := d.Canonical("_cell_length_a"); got != "cell.length_a" {
+		t.Fatalf("Wrong canonical data tag: '%s'.", got)
+	}
+	item = d.Item("_cell.setting")
+	if item.Default != "triclinic" || len(item.Enumeration) != 2 {
+		t.Fatalf("Wrong definition of '_cell.setting': %#v", item)
+	}
+
+	// Imported in "Full" mode.
+	if d.Category("atom_head") != nil {
+		t.Fatalf("The head category of an imported dictionary should be " +
+			"dropped.")
+	}
+	cat := d.Category("atom_site")
+	if cat == nil || cat.Parent != "atom" || cat.Class != "Loop" ||
+		!reflect.DeepEqual(cat.Keys, []string{"atom_site.label"}) {
+		t.Fatalf("Wrong category 'atom_site': %#v", cat)
+	}
+	subs := d.SubCategories("TEST_HEAD")
+	if !reflect.DeepEqual(subs, []string{"atom", "cell"}) {
+		t.Fatalf("Wrong subcategories: %v", subs)
+	}
+	parents := d.Parents("atom_site.cell")
+	if !reflect.DeepEqual(parents, []string{"cell.setting"}) {
+		t.Fatalf("Wrong parents: %v", parents)
+	}
+
+	data := `#\#CIF_2.0
+data_test
+_cell.length_a 0.5
+_cell.setting Monoclinic
+_cell.vector [[1 0] [0 1]]
+loop_
+_atom_site.label
+_atom_site.cell
+C1 triclinic
+C1 triclinic
+`
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := problems(t, Validate(&cif.Blocks["test"].Block, d))
+	got := make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	want := []string{
+		"CIF validation error (block 'test', tag 'cell.length_a'): " +
+			"The value '0.5' is not in any of the permitted ranges: 1:..",
+		"CIF validation error (block 'test', tag 'atom_site.label', " +
+			"row 2): The key (atom_site.label) = (C1) is the same as the " +
+			"key of row 1.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	cif, err = Read(strings.NewReader(cifDDLm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDDLm(cif, filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("Loading a dictionary with missing imports should fail.")
+	}
+
+	// Imports cannot escape the directory, even when the file exists.
+	escape := `#\#CIF_2.0
+data_ESCAPE
+save_cell.length_a
+    _definition.id               '_cell.length_a'
+    _import.get   [{'file':'../templ_attr.cif' 'save':'cell_length'}]
+save_
+`
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cif, err = Read(strings.NewReader(escape))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadDDLm(cif, filepath.Join(dir, "sub"))
+	if err == nil || !strings.Contains(err.Error(), "outside of the") {
+		t.Fatalf("Importing a file outside of the directory should fail, "+
+			"but got '%v'.", err)
+	}
+}
+
+// problems returns the problems in an error returned by Validate or
+// CheckLinks, which must be nil or have type ValidationErrors.
+func problems(t *testing.T, err error) ValidationErrors {
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Problems should have type ValidationErrors, but got "+
+			"'%T': %s", err, err)
+	}
+	return errs
+}
+
+func TestCheckLinks(t *testing.T) {
+	d := &Dictionary{Links: []Link{
+		{Child: "atom_site.label_entity_id", Parent: "entity.id"},
+		{Child: "atom_site.label_seq_id", Parent: "entity_poly_seq.num",
+			Group: "atom_site:1"},
+		{Child: "atom_site.label_comp_id", Parent: "entity_poly_seq.mon_id",
+			Group: "atom_site:1"},
+		{Child: "struct.entry_id", Parent: "entry.id"},
+		{Child: "exptl.entry_id", Parent: "entry.id"},
+		{Child: "missing.id", Parent: "entity.id"},
+	}}
+	data := `data_links
+_entry.id 1ABC
+_struct.entry_id 1ABC
+_exptl.entry_id 2XYZ
+_entity.id 1
+loop_
+_entity_poly_seq.num
+_entity_poly_seq.mon_id
+1 MET
+2 ALA
+loop_
+_atom_site.id
+_atom_site.label_entity_id
+_atom_site.label_seq_id
+_atom_site.label_comp_id
+1 1 1 MET
+2 1 2 GLY
+3 2 2 ALA
+4 . . HOH
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := problems(t, CheckLinks(&cif.Blocks["links"].Block, d))
+	got := make([]string, len(errs))
+	for i, err := range errs {
+		got[i] = err.Error()
+	}
+	want := []string{
+		"CIF validation error (block 'links', tag " +
+			"'atom_site.label_entity_id', row 3): The value '2' has no " +
+			"matching value of the parent data item 'entity.id'.",
+		"CIF validation error (block 'links', tag 'atom_site.label_seq_id', " +
+			"row 2): The values (2, GLY) of (atom_site.label_seq_id, " +
+			"atom_site.label_comp_id) have no matching row of the parent " +
+			"data items (entity_poly_seq.num, entity_poly_seq.mon_id).",
+		"CIF validation error (block 'links', tag 'exptl.entry_id'): The " +
+			"value '2XYZ' has no matching value of the parent data item " +
+			"'entry.id'.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Problems should be\n%s\nbut are\n%s",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	delete(cif.Blocks["links"].Items, "entity.id")
+	errs = problems(t, CheckLinks(&cif.Blocks["links"].Block, d))
+	if len(errs) != 3 || errs[0].Row != 0 ||
+		errs[0].Tag != "atom_site.label_entity_id" {
+		t.Fatalf("A missing parent should be reported once: %s", errs)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifDDL1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL1(cif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := d.Item("space_group_name_H-M_alt")
+	aliases := []string{"symmetry_space_group_name_h-m"}
+	if !reflect.DeepEqual(item.Aliases, aliases) {
+		t.Fatalf("Aliases should be %v but are %v.", aliases, item.Aliases)
+	}
+	for tag, want := range map[string]string{
+		"_symmetry_space_group_name_H-M": "space_group_name_h-m_alt",
+		"_space_group_name_H-M_alt":      "space_group_name_h-m_alt",
+		"_unknown":                       "unknown",
+	} {
+		if got := d.Canonical(tag); got != want {
+			t.Fatalf("Canonical of '%s' should be '%s' but is '%s'.",
+				tag, want, got)
+		}
+	}
+	names := d.Names("symmetry_space_group_name_h-m")
+	want := []string{
+		"space_group_name_h-m_alt", "symmetry_space_group_name_h-m",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Names should be %v but are %v.", want, names)
+	}
+
+	// Aliases of DDL2 data items come from their save frames.
+	cif2, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := LoadDDL2(cif2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d2.Canonical("atom_site_B_iso_or_equiv"); got !=
+		"atom_site.b_iso" {
+		t.Fatalf("Wrong canonical data tag: '%s'.", got)
+	}
+
+	data := `data_old
+_symmetry_space_group_name_H-M 'P 1'
+_cell_length_a 5.0
+loop_
+_atom_site_label
+_atom_site_occupancy
+C1 1.0
+save_frame
+_symmetry_space_group_name_H-M 'P 2'
+save_
+data_new
+_space_group_name_H-M_alt 'P 3'
+`
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for block, want := range map[string]string{"old": "P 1", "new": "P 3"} {
+		b := &cif.Blocks[block].Block
+		val, ok := b.Lookup("_space_group_name_H-M_alt", d)
+		if !ok || val.String() != want {
+			t.Fatalf("Lookup in '%s' should find '%s' but got %v.",
+				block, want, val)
+		}
+	}
+	b := &cif.Blocks["new"].Block
+	if tag, ok := b.ResolveTag("symmetry_space_group_name_h-m", d); !ok ||
+		tag != "space_group_name_h-m_alt" {
+		t.Fatalf("Looking up an alias should find the current data tag, "+
+			"but got '%s'.", tag)
+	}
+	b = &cif.Blocks["old"].Block
+	col, ok := b.LookupColumn("atom_site_label", d)
+	if !ok || !reflect.DeepEqual(col.Strings(), []string{"C1"}) {
+		t.Fatalf("Wrong column: %v", col)
+	}
+	if _, ok := b.LookupColumn("cell_length_a", d); ok {
+		t.Fatalf("A data item not in a table should not have a column.")
+	}
+	if _, ok := b.Lookup("cell_length_b", d); ok {
+		t.Fatalf("A missing data item should not be found.")
+	}
+
+	migrated, err := cif.Migrate(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := migrated.Validate(); errs != nil {
+		t.Fatalf("Migrated CIF is not valid:\n%s", errs)
+	}
+	old := migrated.Blocks["old"]
+	if _, ok := old.Items["symmetry_space_group_name_h-m"]; ok {
+		t.Fatalf("The alias should have been replaced.")
+	}
+	if val := old.Items["space_group_name_h-m_alt"]; val.String() != "P 1" {
+		t.Fatalf("Wrong migrated value: %v", val)
+	}
+	frame := old.Frames["frame"]
+	if val := frame.Items["space_group_name_h-m_alt"]; val == nil ||
+		val.String() != "P 2" {
+		t.Fatalf("Wrong migrated value in save frame: %v", val)
+	}
+	if _, ok := cif.Blocks["old"].Items["symmetry_space_group_name_h-m"]; !ok {
+		t.Fatalf("Migrating should not modify the original CIF.")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := migrated.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "_symmetry_space_group_name_h-m") {
+		t.Fatalf("The alias should not be written:\n%s", buf)
+	}
+
+	data += "_symmetry_space_group_name_H-M 'P 3'\n"
+	cif, err = Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cif.Migrate(d); err == nil {
+		t.Fatalf("Migrating a block with both an alias and its data item " +
+			"should fail.")
+	}
+}
+
+func TestWriteGo(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(cif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = d.WriteGo(buf, GoOptions{
+		Package:    "pdbx",
+		Categories: []string{"_ATOM_SITE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Code generated from the CIF dictionary test.dic (version " +
+		"1.0). DO NOT EDIT.\n" + `
+package pdbx
+
+// AtomSite contains the data items of the category "atom_site".
+//
+// Data items describing atom sites.
+type AtomSite struct {
+	BIso float64 ` + "`" + `cif:"atom_site.b_iso"` + "`" + `
+
+	// The identifier of the atom site.
+	ID string ` + "`" + `cif:"atom_site.id"` + "`" + `
+
+	Type string ` + "`" + `cif:"atom_site.type"` + "`" + `
+}
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("Go source code should be\n%s\nbut is\n%s", want, got)
+	}
+
+	err = d.WriteGo(new(bytes.Buffer), GoOptions{
+		Package:    "pdbx",
+		Categories: []string{"missing"},
+	})
+	if err == nil {
+		t.Fatalf("Writing types for a missing category should fail.")
+	}
+
+	for s, want := range map[string]string{
+		"name_h-m_alt":  "NameHMAlt",
+		"pdbx_entry_id": "PdbxEntryID",
+		"2fo_fc":        "X2foFc",
+		"":              "X",
+	} {
+		if got := goName(s); got != want {
+			t.Fatalf("Go name of '%s' should be '%s' but is '%s'.",
+				s, want, got)
+		}
+	}
+	desc := goComment("A long description that needs to be filled to fit "+
+		"within the\n  columns of a line.\n \n  Another paragraph.", "\t")
+	wantDesc := "\t// A long description that needs to be filled to fit " +
+		"within the columns\n\t// of a line.\n\t//\n\t// Another " +
+		"paragraph.\n"
+	if desc != wantDesc {
+		t.Fatalf("Comment should be\n%s\nbut is\n%s", wantDesc, desc)
+	}
+}
+
+// testAtomSite and testAtomSitePtr are the types written by WriteGo for the
+// category "atom_site" of cifDDL2, without and with GoOptions.Pointers.
+type testAtomSite struct {
+	BIso float64 `cif:"atom_site.b_iso"`
+	ID   string  `cif:"atom_site.id"`
+	Type string  `cif:"atom_site.type"`
+}
+
+type testAtomSitePtr struct {
+	BIso *float64 `cif:"atom_site.b_iso"`
+	ID   *string  `cif:"atom_site.id"`
+	Type *string  `cif:"atom_site.type"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	dcif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(dcif)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test types must match the generated source code.
+	for _, v := range []interface{}{testAtomSite{}, testAtomSitePtr{}} {
+		typ := reflect.TypeOf(v)
+		buf := new(bytes.Buffer)
+		err := d.WriteGo(buf, GoOptions{
+			Package:    "pdbx",
+			Categories: []string{"atom_site"},
+			Pointers:   typ.Field(0).Type.Kind() == reflect.Ptr,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			decl := sf("\t%s %s `%s`\n", f.Name, f.Type, f.Tag)
+			if !strings.Contains(buf.String(), decl) {
+				t.Fatalf("The Go source code should declare\n%s\nbut is\n%s",
+					decl, buf.String())
+			}
+		}
+	}
+
+	data := `data_test
+_cell.length_a 10.0
+loop_
+_atom_site.id
+_atom_site.type
+_atom_site.B_iso
+1 C 1.5(2)
+2 N ?
+3 . 7
+`
+	cif, err := ReadWith(strings.NewReader(data), ReadOptions{Dictionary: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &cif.Blocks["test"].Block
+
+	var sites []testAtomSite
+	if err := b.Unmarshal(&sites); err != nil {
+		t.Fatal(err)
+	}
+	want := []testAtomSite{{1.5, "1", "C"}, {0, "2", "N"}, {7, "3", ""}}
+	if !reflect.DeepEqual(sites, want) {
+		t.Fatalf("Rows should be %v but are %v.", want, sites)
+	}
+
+	var ptrs []testAtomSitePtr
+	if err := b.Unmarshal(&ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 3 || *ptrs[0].BIso != 1.5 || *ptrs[0].Type != "C" ||
+		ptrs[1].BIso != nil || *ptrs[2].BIso != 7 || ptrs[2].Type != nil {
+
+		t.Fatalf("Null values should be nil and others not: %#v", ptrs)
+	}
+
+	// Data items are a single row, and missing data tags are null.
+	var cells []struct {
+		A float64  `cif:"_cell.length_a"`
+		B *float64 `cif:"_cell.length_b"`
+	}
+	if err := b.Unmarshal(&cells); err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 1 || cells[0].A != 10 || cells[0].B != nil {
+		t.Fatalf("Expected a single row with only a length, but got %v.",
+			cells)
+	}
+
+	// Columns created with AsValues have no texts of their own.
+	built := &Block{Loops: map[string]*Loop{}}
+	built.Loops["atom_site.id"] = &Loop{
+		Columns: map[string]int{"atom_site.id": 0, "atom_site.b_iso": 1},
+		Values: []ValueLoop{
+			AsValues([]int{1, 2}), AsValues([]float64{0.5, 2}),
+		},
+	}
+	built.Loops["atom_site.b_iso"] = built.Loops["atom_site.id"]
+	if err := built.Unmarshal(&sites); err != nil {
+		t.Fatal(err)
+	}
+	want = []testAtomSite{{0.5, "1", ""}, {2, "2", ""}}
+	if !reflect.DeepEqual(sites, want) {
+		t.Fatalf("Rows should be %v but are %v.", want, sites)
+	}
+
+	var ints []struct {
+		BIso int `cif:"atom_site.b_iso"`
+	}
+	var mixed []struct {
+		ID string  `cif:"atom_site.id"`
+		A  float64 `cif:"cell.length_a"`
+	}
+	var unsupported []struct {
+		ID []string `cif:"atom_site.id"`
+	}
+	tests := []struct {
+		v   interface{}
+		err string
+	}{
+		{sites, "needs a pointer to a slice of structs"},
+		{&ints, "Could not unmarshal row 1 of data tag 'atom_site.b_iso': " +
+			"The value '1.5(2)' is not an integer."},
+		{&mixed, "are in a table and some are not"},
+		{&unsupported, "cannot hold CIF values"},
+	}
+	for _, test := range tests {
+		err := b.Unmarshal(test.v)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("Expected an error containing '%s', but got '%v'.",
+				test.err, err)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(cif)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An alias is described by the data item it names.
+	doc, err := d.Describe("_atom_site_B_iso_or_equiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Data item:   _atom_site.b_iso
+Aliases:     _atom_site_b_iso_or_equiv
+Category:    atom_site (keys: _atom_site.id)
+Type:        float (numb)
+Construct:   -?(([0-9]+)[.]?|([0-9]*[.][0-9]+))([(][0-9]+[)])?([eE][+-]?[0-9]+)?
+Units:       angstroms_squared (angstroms squared)
+Ranges:      0:. (exclusive)
+             0:0
+
+Category atom_site:
+             Data items describing atom sites.
+`
+	if doc != want {
+		t.Fatalf("Documentation should be\n%s\nbut is\n%s", want, doc)
+	}
+
+	doc, err = d.Describe("atom_site.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"Type detail: code item types/single words\n",
+		"Mandatory:   yes\n",
+		"Children:    _atom_site_anisotrop.id\n",
+		"\nDescription:\n             The identifier of the atom site.\n",
+	} {
+		if !strings.Contains(doc, line) {
+			t.Fatalf("Documentation should contain\n%s\nbut is\n%s",
+				line, doc)
+		}
+	}
+	doc, err = d.Describe("atom_site.type")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc, "Enumeration: ATOM\n             HETATM\n") {
+		t.Fatalf("Documentation should list permitted values:\n%s", doc)
+	}
+
+	if _, err := d.Describe("_atom_site.missing"); err == nil {
+		t.Fatalf("Describing a missing data item should fail.")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var dicts []*Dictionary
+	for _, src := range []string{cifDDL2, cifDDL1} {
+		cif, err := Read(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		load := LoadDDL2
+		if src == cifDDL1 {
+			load = LoadDDL1
+		}
+		d, err := load(cif)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dicts = append(dicts, d)
+	}
+
+	for i, d := range dicts {
+		for seed := int64(0); seed < 50; seed++ {
+			opts := GenerateOptions{Seed: seed, Rows: 4}
+			cif, err := Generate(d, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errs := cif.Validate(); errs != nil {
+				t.Fatalf("Generated CIF is not valid:\n%s", errs)
+			}
+			b := &cif.Blocks["synthetic"].Block
+			errs := append(problems(t, Validate(b, d)),
+				problems(t, CheckLinks(b, d))...)
+			if len(errs) > 0 {
+				t.Fatalf("Generated CIF (dictionary %d, seed %d) does not "+
+					"conform to the dictionary:\n%s", i, seed, errs)
+			}
+
+			// The CIF is written and read back without changes.
+			buf := new(bytes.Buffer)
+			if err := cif.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			written := buf.String()
+			read, err := ReadWith(buf, ReadOptions{Dictionary: d})
+			if err != nil {
+				t.Fatalf("Could not read generated CIF: %s\n%s", err, written)
+			}
+			if !reflect.DeepEqual(read, cif) {
+				t.Fatalf("Generated CIF changed after writing and reading "+
+					"it:\n%s", written)
+			}
+
+			again, err := Generate(d, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, cif) {
+				t.Fatalf("Generating with the same seed should produce " +
+					"the same CIF.")
+			}
+		}
+	}
+
+	// Ranges too large for an int are clamped instead of panicking.
+	g := &generator{rand: rand.New(rand.NewSource(1))}
+	huge := []Range{
+		{Min: -9e18, HasMin: true, Max: 9e18, HasMax: true},
+		{Min: -1e300, HasMin: true, Max: 1e300, HasMax: true},
+		{Min: math.MaxInt64, HasMin: true},
+		{Max: math.MinInt64, HasMax: true},
+	}
+	for _, r := range huge {
+		s := g.number(itemDataInteger, r)
+		if _, err := strconv.Atoi(s); err != nil {
+			t.Fatalf("Generated '%s' for the range %v: %s", s, r, err)
+		}
+	}
+
+	d := dicts[0]
+	cif, err := Generate(d, GenerateOptions{
+		Categories: []string{"atom_site_anisotrop"},
+		Block:      "Test",
+		Seed:       1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := cif.Blocks["test"]
+	if b == nil {
+		t.Fatalf("The data block should be named 'test'.")
+	}
+	if _, ok := b.Loops["atom_site.id"]; !ok {
+		t.Fatalf("The parent category 'atom_site' should be generated.")
+	}
+	if lp := b.Loops["atom_site_anisotrop.id"]; lp == nil ||
+		len(Texts(lp.Get("atom_site_anisotrop.id"))) != 3 {
+		t.Fatalf("The category 'atom_site_anisotrop' should have 3 rows.")
+	}
+	cif, err = Generate(dicts[1], GenerateOptions{
+		Categories: []string{"symmetry"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = cif.Blocks["synthetic"]
+	if _, ok := b.Items["symmetry_space_group_name_h-m"]; ok {
+		t.Fatalf("A data item replaced by another should not be generated.")
+	}
+	if _, ok := b.Items["symmetry_cell_setting"]; !ok {
+		t.Fatalf("A data item that must not be in a table should not be " +
+			"in a table.")
+	}
+	if _, err := Generate(d, GenerateOptions{
+		Categories: []string{"missing"},
+	}); err == nil {
+		t.Fatalf("Generating a missing category should fail.")
+	}
+}
+
+func TestInfer(t *testing.T) {
+	corpus := []string{`data_a
+_local.method xray
+_local.count 3
+loop_
+_local_site.id
+_local_site.x
+_local_site.label
+1 1.5 'C A'
+2 -0.5(2) N
+3 2e1 ?
+`, `data_b
+_local.method xray
+loop_
+_local_site.id
+_local_site.x
+_local_site.label
+1 . O
+2 3 C
+`}
+	inf := NewInferrer()
+	var cifs []*CIF
+	for _, src := range corpus {
+		cif, err := Read(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inf.Add(cif)
+		cifs = append(cifs, cif)
+	}
+	d := inf.Dictionary("local.dic")
+
+	tests := []struct {
+		tag, typ, list string
+		mandatory      bool
+		enumeration    []string
+		ranges         []Range
+	}{
+		{"local.method", "code", "no", true, []string{"xray"}, nil},
+		{"local.count", "int", "no", false, nil,
+			[]Range{{Min: 3, Max: 3, HasMin: true, HasMax: true}}},
+		{"local_site.id", "int", "yes", true, nil,
+			[]Range{{Min: 1, Max: 3, HasMin: true, HasMax: true}}},
+		{"local_site.x", "float", "yes", true, nil,
+			[]Range{{Min: -0.5, Max: 20, HasMin: true, HasMax: true}}},
+		{"local_site.label", "line", "yes", false, nil, nil},
+	}
+	for _, test := range tests {
+		item := d.Items[test.tag]
+		if item == nil {
+			t.Fatalf("The data item '%s' should be inferred.", test.tag)
+		}
+		if item.Type != test.typ || item.List != test.list ||
+			item.Mandatory != test.mandatory {
+			t.Fatalf("The data item '%s' should have type %s, list %s and "+
+				"mandatory %v, but has %s, %s and %v.", test.tag, test.typ,
+				test.list, test.mandatory, item.Type, item.List,
+				item.Mandatory)
+		}
+		if !reflect.DeepEqual(item.Enumeration, test.enumeration) {
+			t.Fatalf("The enumeration of '%s' should be %v but is %v.",
+				test.tag, test.enumeration, item.Enumeration)
+		}
+		if !reflect.DeepEqual(item.Ranges, test.ranges) {
+			t.Fatalf("The ranges of '%s' should be %v but are %v.",
+				test.tag, test.ranges, item.Ranges)
+		}
+	}
+	if keys := d.Categories["local_site"].Keys; !reflect.DeepEqual(keys,
+		[]string{"local_site.id"}) {
+
+		t.Fatalf("The keys of 'local_site' should be [local_site.id] "+
+			"but are %v.", keys)
+	}
+	if keys := d.Categories["local"].Keys; len(keys) > 0 {
+		t.Fatalf("The category 'local' should not have keys, but has %v.",
+			keys)
+	}
+
+	// The dictionary is written as DDL2, read back, and the data it was
+	// inferred from conforms to it.
+	buf := new(bytes.Buffer)
+	if err := d.DDL2().Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+	dcif, err := Read(buf)
+	if err != nil {
+		t.Fatalf("Could not read the DDL2 dictionary: %s\n%s", err, written)
+	}
+	loaded, err := LoadDDL2(dcif)
+	if err != nil {
+		t.Fatalf("Could not load the DDL2 dictionary: %s\n%s", err, written)
+	}
+	if loaded.Title != "local.dic" || len(loaded.Items) != len(d.Items) {
+		t.Fatalf("The DDL2 dictionary should have the title 'local.dic' "+
+			"and %d data items:\n%s", len(d.Items), written)
+	}
+	if item := loaded.Items["local_site.x"]; item.Type != "float" ||
+		!item.Mandatory {
+
+		t.Fatalf("The data item 'local_site.x' was not written correctly:"+
+			"\n%s", written)
+	}
+	for _, cif := range cifs {
+		for _, b := range cif.Blocks {
+			if err := Validate(&b.Block, loaded); err != nil {
+				t.Fatalf("The data should conform to the inferred "+
+					"dictionary:\n%s\n%s", err, written)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package cif
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the data items in a block against a dictionary and returns
+// every problem found. In particular, Validate checks that:
+//
+// Every data tag in the block is defined in the dictionary.
+//
+// Every value matches the regular expression of its type, is one of the
+// enumerated values of its data item (if any) and, if it is a number, falls
+// in one of the ranges of its data item (if any). Omitted (".") and missing
+// ("?") values are not checked, and neither are the values of DDLm data items
+// whose container is not "Single".
+//
+// Every mandatory category is present, and every mandatory data item of a
+// category is present (and not missing) whenever any data item of that
+// category is present.
+//
+// The values of the keys of each category are unique across its rows.
+//
+// Data items are in a table or not, as required by their looping rules (see
+// ItemDef.List).
+//
+// Validate works with dictionaries of any DDL version (see LoadDDL1 and
+// LoadDDL2).
+//
+// Problems in a table include the row of the value. If there are no
+// problems, then nil is returned. Otherwise, the error returned has type
+// ValidationErrors, which lists every problem in a deterministic order.
+func Validate(b *Block, d *Dictionary) error {
+	v := &validator{block: b.Name}
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+	tags = ordered(b.order, tags, lessTag)
+
+	present := make(map[string]bool, 20)
+	for _, tag := range tags {
+		item := d.Item(tag)
+		if item == nil {
+			v.errf(tag, 0, "The data tag is not defined in the dictionary.")
+			continue
+		}
+		present[item.Category] = true
+
+		_, inLoop := b.Loops[tag]
+		switch {
+		case item.List == "yes" && !inLoop:
+			v.errf(tag, 0, "The data item must be in a table.")
+		case item.List == "no" && inLoop:
+			v.errf(tag, 0, "The data item must not be in a table.")
+		}
+		for i, s := range dictColumn(b, tag) {
+			row := 0
+			if inLoop {
+				row = i + 1
+			}
+			v.validateDictValue(d, item, tag, row, s)
+		}
+	}
+
+	cats := make([]string, 0, len(d.Categories))
+	for name := range d.Categories {
+		cats = append(cats, name)
+	}
+	sort.Strings(cats)
+	for _, name := range cats {
+		cat := d.Categories[name]
+		if !present[name] {
+			if cat.Mandatory {
+				v.errf("", 0, "The mandatory category '%s' is missing.", name)
+			}
+			continue
+		}
+		v.validateMandatory(b, d, cat)
+		v.validateKeys(b, cat)
+	}
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// validateDictValue checks a single value against the definition of its data
+// item.
+func (v *validator) validateDictValue(d *Dictionary, item *ItemDef,
+	tag string, row int, s string) {
+
+	if isNullText(s) {
+		return
+	}
+	if len(item.Container) > 0 && !strings.EqualFold(item.Container, "single") {
+		// Only single values are checked. Lists, tables and so on are not.
+		return
+	}
+	typ := d.Types[item.Type]
+	if typ != nil && !typ.Match(s) {
+		v.errf(tag, row, "The value '%s' does not match the type '%s'.",
+			s, typ.Code)
+		return
+	}
+	if len(item.Enumeration) > 0 {
+		fold := typ != nil && typ.Primitive == "uchar"
+		if !isEnumerated(item.Enumeration, s, fold) {
+			v.errf(tag, row, "The value '%s' is not one of the permitted "+
+				"values: %s.", s, strings.Join(item.Enumeration, ", "))
+			return
+		}
+	}
+	if len(item.Ranges) > 0 {
+		f, ok := parseNumber(s)
+		if !ok {
+			return
+		}
+		for _, r := range item.Ranges {
+			if r.Contains(f) {
+				return
+			}
+		}
+		ranges := make([]string, len(item.Ranges))
+		for i, r := range item.Ranges {
+			ranges[i] = r.String()
+		}
+		v.errf(tag, row, "The value '%s' is not in any of the permitted "+
+			"ranges: %s.", s, strings.Join(ranges, ", "))
+	}
+}
+
+// validateMandatory checks that every mandatory data item of a category is
+// present and not missing.
+func (v *validator) validateMandatory(b *Block, d *Dictionary,
+	cat *CategoryDef) {
+
+	for _, tag := range cat.Items {
+		if !d.Items[tag].Mandatory {
+			continue
+		}
+		vals := dictColumn(b, tag)
+		if vals == nil {
+			v.errf(tag, 0, "The mandatory data item is missing from "+
+				"category '%s'.", cat.Name)
+			continue
+		}
+		_, inLoop := b.Loops[tag]
+		for i, s := range vals {
+			if s != "?" {
+				continue
+			}
+			row := 0
+			if inLoop {
+				row = i + 1
+			}
+			v.errf(tag, row, "The mandatory data item has a missing value.")
+		}
+	}
+}
+
+// validateKeys checks that the values of the keys of a category are unique
+// across its rows. Categories whose keys are not all present are not
+// checked.
+func (v *validator) validateKeys(b *Block, cat *CategoryDef) {
+	if len(cat.Keys) == 0 {
+		return
+	}
+	columns := make([][]string, len(cat.Keys))
+	rows := 0
+	for i, key := range cat.Keys {
+		columns[i] = dictColumn(b, key)
+		if columns[i] == nil {
+			return
+		}
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+
+	seen := make(map[string]int, rows)
+	for row := 0; row < rows; row++ {
+		vals := make([]string, len(columns))
+		for i := range columns {
+			vals[i] = valueAt(columns[i], row)
+		}
+		key := strings.Join(vals, "\x00")
+		if first, ok := seen[key]; ok {
+			v.errf(cat.Keys[0], row+1, "The key (%s) = (%s) is the same as "+
+				"the key of row %d.", strings.Join(cat.Keys, ", "),
+				strings.Join(vals, ", "), first)
+			continue
+		}
+		seen[key] = row + 1
+	}
+}
+
+// isEnumerated returns true if s is one of the values given. If fold is
+// true, then case is ignored.
+func isEnumerated(values []string, s string, fold bool) bool {
+	for _, val := range values {
+		if val == s || (fold && strings.EqualFold(val, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number as written in CIF data, which may be followed
+// by a standard uncertainty in parentheses. e.g., "1.234(5)".
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(trimUncertainty(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
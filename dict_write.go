@@ -0,0 +1,244 @@
+package cif
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DDL2 returns the dictionary as a DDL2 dictionary (in the style of
+// mmcif_pdbx.dic), which may be written with Write and loaded again with
+// LoadDDL2. The dictionary is a single data block, named after the title of
+// the dictionary, containing the types, units and links of the dictionary
+// along with a save frame for each category and for each data item.
+// Categories and data items are written in sorted order.
+//
+// Ranges that include their bounds (like those of DDL1 dictionaries) are
+// written as DDL2 ranges (which exclude their bounds) along with ranges
+// consisting of just their bounds. Looping rules and the attributes specific
+// to DDLm dictionaries have no equivalent in DDL2, so they are not written.
+func (d *Dictionary) DDL2() *CIF {
+	name := strings.ToLower(strings.Join(strings.Fields(d.Title), "_"))
+	if len(name) == 0 {
+		name = "dictionary"
+	}
+	b := &DataBlock{
+		Block:  newBlock(name),
+		Frames: make(map[string]*SaveFrame, len(d.Categories)+len(d.Items)),
+	}
+	b.addText("dictionary.title", d.Title)
+	b.addText("dictionary.version", d.Version)
+
+	cats := make([]string, 0, len(d.Categories))
+	for name := range d.Categories {
+		cats = append(cats, name)
+	}
+	sort.Strings(cats)
+	for _, name := range cats {
+		cat := d.Categories[name]
+		frame := newBlock(name)
+		frame.addText("category.description", cat.Description)
+		frame.addText("category.id", name)
+		frame.addText("category.mandatory_code", yesNo(cat.Mandatory))
+		frame.addTable([]string{"category_key.name"}, underscored(cat.Keys))
+		frame.addTable([]string{"category_group.id"}, cat.Groups)
+		b.addFrame(frame)
+	}
+
+	items := make([]string, 0, len(d.Items))
+	for name := range d.Items {
+		items = append(items, name)
+	}
+	sort.Strings(items)
+	for _, name := range items {
+		b.addFrame(d.ddl2Item(d.Items[name]))
+	}
+
+	types := make([]string, 0, len(d.Types))
+	for code := range d.Types {
+		types = append(types, code)
+	}
+	sort.Strings(types)
+	cols := make([][]string, 4)
+	for _, code := range types {
+		typ := d.Types[code]
+		cols[0] = append(cols[0], code)
+		cols[1] = append(cols[1], typ.Primitive)
+		cols[2] = append(cols[2], typ.Construct)
+		cols[3] = append(cols[3], typ.Detail)
+	}
+	b.addTable([]string{
+		"item_type_list.code", "item_type_list.primitive_code",
+		"item_type_list.construct", "item_type_list.detail",
+	}, cols...)
+
+	units := make([]string, 0, len(d.Units))
+	for code := range d.Units {
+		units = append(units, code)
+	}
+	sort.Strings(units)
+	cols = make([][]string, 2)
+	for _, code := range units {
+		cols[0] = append(cols[0], code)
+		cols[1] = append(cols[1], d.Units[code])
+	}
+	b.addTable([]string{
+		"item_units_list.code", "item_units_list.detail",
+	}, cols...)
+
+	links, groups := make([][]string, 2), make([][]string, 5)
+	for _, link := range d.Links {
+		if len(link.Group) == 0 {
+			links[0] = append(links[0], "_"+link.Child)
+			links[1] = append(links[1], "_"+link.Parent)
+			continue
+		}
+		cat, id := tagCategory(link.Child), link.Group
+		if i := strings.LastIndex(link.Group, ":"); i > -1 {
+			cat, id = link.Group[:i], link.Group[i+1:]
+		}
+		parent := tagCategory(link.Parent)
+		if item := d.Items[link.Parent]; item != nil {
+			parent = item.Category
+		}
+		groups[0] = append(groups[0], cat)
+		groups[1] = append(groups[1], id)
+		groups[2] = append(groups[2], "_"+link.Child)
+		groups[3] = append(groups[3], "_"+link.Parent)
+		groups[4] = append(groups[4], parent)
+	}
+	b.addTable([]string{
+		"item_linked.child_name", "item_linked.parent_name",
+	}, links...)
+	b.addTable([]string{
+		"pdbx_item_linked_group_list.child_category_id",
+		"pdbx_item_linked_group_list.link_group_id",
+		"pdbx_item_linked_group_list.child_name",
+		"pdbx_item_linked_group_list.parent_name",
+		"pdbx_item_linked_group_list.parent_category_id",
+	}, groups...)
+
+	return &CIF{
+		Blocks: map[string]*DataBlock{name: b},
+		order:  []string{name},
+	}
+}
+
+// ddl2Item returns the save frame defining a data item in a DDL2
+// dictionary.
+func (d *Dictionary) ddl2Item(item *ItemDef) Block {
+	frame := newBlock("_" + item.Name)
+	frame.addText("item_description.description", item.Description)
+	frame.addText("item.name", "_"+item.Name)
+	frame.addText("item.category_id", item.Category)
+	frame.addText("item.mandatory_code", yesNo(item.Mandatory))
+	frame.addTable([]string{"item_aliases.alias_name"},
+		underscored(item.Aliases))
+	frame.addText("item_type.code", item.Type)
+	frame.addText("item_units.code", item.Units)
+	frame.addText("item_default.value", item.Default)
+	frame.addTable([]string{"item_enumeration.value"}, item.Enumeration)
+
+	bound := func(has bool, f float64) string {
+		if !has {
+			return "."
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	maxs, mins := make([]string, 0), make([]string, 0)
+	add := func(max, min string) {
+		maxs, mins = append(maxs, max), append(mins, min)
+	}
+	for _, r := range item.Ranges {
+		min, max := bound(r.HasMin, r.Min), bound(r.HasMax, r.Max)
+		add(max, min)
+		if r.Exclusive || (r.HasMin && r.HasMax && r.Min == r.Max) {
+			continue
+		}
+		if r.HasMin {
+			add(min, min)
+		}
+		if r.HasMax {
+			add(max, max)
+		}
+	}
+	frame.addTable([]string{"item_range.maximum", "item_range.minimum"},
+		maxs, mins)
+	return frame
+}
+
+// newBlock returns an empty block with the name given.
+func newBlock(name string) Block {
+	return Block{
+		Name:  name,
+		Items: make(map[string]Value, 10),
+		Loops: make(map[string]*Loop, 5),
+	}
+}
+
+// addText adds a data item to the block, unless its value is empty. A value
+// that is a number is written as a number.
+func (b *Block) addText(tag, s string) {
+	if len(s) == 0 {
+		return
+	}
+	if f, ok := textNumber(s); ok {
+		b.Items[tag] = cifFloat{f: f, text: s}
+	} else {
+		b.Items[tag] = cifString(s)
+	}
+	b.order = append(b.order, tag)
+}
+
+// addTable adds a table to the block, unless it has no rows. Empty values are
+// written as missing ("?"), and a column of numbers is written as numbers.
+func (b *Block) addTable(tags []string, columns ...[]string) {
+	if len(columns) == 0 || len(columns[0]) == 0 {
+		return
+	}
+	lp := &Loop{
+		Columns: make(map[string]int, len(tags)),
+		Values:  make([]ValueLoop, len(tags)),
+	}
+	for i, tag := range tags {
+		texts := make([]string, len(columns[i]))
+		floats := make([]float64, len(columns[i]))
+		numeric := true
+		for j, s := range columns[i] {
+			if len(s) == 0 {
+				s = "?"
+			}
+			texts[j] = s
+			if !isNullText(s) {
+				var ok bool
+				floats[j], ok = textNumber(s)
+				numeric = numeric && ok
+			}
+		}
+		if numeric {
+			lp.Values[i] = cifFloats{floats: floats, texts: texts}
+		} else {
+			lp.Values[i] = cifStrings(texts)
+		}
+		lp.Columns[tag] = i
+		b.Loops[tag] = lp
+		b.order = append(b.order, tag)
+	}
+}
+
+// textNumber returns the number written in s, if s would be read as a
+// number.
+func textNumber(s string) (float64, bool) {
+	if !matchNumeric.MatchString(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// addFrame adds a save frame to the data block.
+func (b *DataBlock) addFrame(frame Block) {
+	name := strings.ToLower(frame.Name)
+	b.Frames[name] = &SaveFrame{Block: frame}
+	b.frameOrder = append(b.frameOrder, name)
+}
@@ -5,7 +5,17 @@ of the CIF specification:
 http://www.iucr.org/resources/cif/spec/version1.1/cifsyntax
 
 This package should conform to the entirety of the specification, except it
-does not enforce maximum line length limits while reading or writing CIF files.
-This behavior may be changed in the future.
+does not enforce maximum line length limits while reading CIF files. A maximum
+line length may be enforced while writing CIF files (see WriteOptions). Text
+fields using the line folding protocol are unfolded when read.
+
+Files starting with the version annotation "#\#CIF_2.0" are read as CIF 2.0,
+which adds lists, tables and triple-quoted strings (as used by DDLm
+dictionaries). The writer only writes CIF 1.1.
+
+BinaryCIF (the compressed binary format of CIF data distributed by the RCSB
+PDB and PDBe) is read with ReadBinary and written with CIF.WriteBinary.
+CIF data may also be written as CIF-JSON (the IUCr's standard representation
+of CIF data in JSON) with CIF.WriteJSON.
 */
 package cif
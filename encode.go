@@ -0,0 +1,294 @@
+package cif
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Encoder writes CIF data directly to an io.Writer, one data item or table
+// row at a time. Unlike Write, an Encoder never needs an entire CIF in
+// memory, which makes it appropriate for writing very large tables (like the
+// atom sites of an mmCIF file).
+//
+// Data tags are given without their leading underscore, just as they are
+// stored in Block. Values may have type string, int, float64 or Value.
+// Strings are quoted using the same rules as Write.
+//
+// Every method of an Encoder returns the first error encountered (if any).
+// After an error, nothing else is written. Close must be called when
+// encoding is finished.
+type Encoder struct {
+	w   *writer
+	buf *bufio.Writer
+	err error
+
+	inBlock, inFrame bool
+	blocks           map[string]bool // names of the data blocks written
+	frames           map[string]bool // names of the frames in the block
+	tags             map[string]bool // tags seen in the current block or frame
+	loop             []string        // tags in the current loop, if any
+	rows             int             // rows written in the current loop
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderWith(w, WriteOptions{})
+}
+
+// NewEncoderWith returns a new Encoder that writes to w using the options
+// given. The Pretty option is ignored, since aligning values requires seeing
+// all of them before writing any of them.
+func NewEncoderWith(w io.Writer, opts WriteOptions) *Encoder {
+	opts.Pretty = false
+	buf := bufio.NewWriter(w)
+	return &Encoder{w: &writer{w: buf, opts: opts}, buf: buf}
+}
+
+// do runs f and records any error raised by the writer. If an error has
+// already been recorded, then f is not run.
+func (e *Encoder) do(f func()) (err error) {
+	if e.err != nil {
+		return e.err
+	}
+	defer func() {
+		if err != nil {
+			e.err = err
+		}
+	}()
+	defer e.w.recover(&err)
+	f()
+	return nil
+}
+
+func (e *Encoder) fail(kind WriteErrorKind,
+	format string, v ...interface{}) error {
+
+	return e.do(func() { e.w.errf(kind, format, v...) })
+}
+
+// Version writes the version comment (e.g., "CIF_1.1") at the start of a CIF
+// file. It must be called before anything else is written.
+func (e *Encoder) Version(version string) error {
+	if e.inBlock {
+		return e.fail(WriteInvalidStructure,
+			"The version must be written before any data block.")
+	}
+	e.w.cif2 = version == "CIF_2.0"
+	return e.do(func() { e.w.pf("#\\#%s\n", version) })
+}
+
+// BeginBlock starts a new data block with the name given. Any open table or
+// save frame is ended first. The name must be a valid name that has not been
+// used for another data block (ignoring case).
+func (e *Encoder) BeginBlock(name string) error {
+	if err := e.EndFrame(); err != nil {
+		return err
+	}
+	if e.blocks == nil {
+		e.blocks = make(map[string]bool, 10)
+	}
+	e.w.block, e.w.frame, e.w.tag = name, "", ""
+	if err := e.addName("data block", name, e.blocks); err != nil {
+		return err
+	}
+	e.inBlock = true
+	e.frames = make(map[string]bool, 10)
+	e.tags = make(map[string]bool, 10)
+	return e.do(func() {
+		e.w.checkLength("data_" + name)
+		e.w.pf("data_%s\n", name)
+	})
+}
+
+// BeginFrame starts a new save frame with the name given in the current data
+// block. Any open table or save frame is ended first. The name must be a
+// valid name that has not been used for another save frame in the data block
+// (ignoring case).
+func (e *Encoder) BeginFrame(name string) error {
+	if !e.inBlock {
+		return e.fail(WriteInvalidStructure,
+			"Save frame '%s' must be written inside a data block.", name)
+	}
+	if err := e.EndFrame(); err != nil {
+		return err
+	}
+	e.w.frame, e.w.tag = name, ""
+	if err := e.addName("save frame", name, e.frames); err != nil {
+		return err
+	}
+	e.inFrame = true
+	e.tags = make(map[string]bool, 10)
+	return e.do(func() {
+		e.w.checkLength("save_" + name)
+		e.w.pf("save_%s\n", name)
+	})
+}
+
+// EndFrame ends the current save frame. Any open table is ended first.
+// If there is no save frame, then EndFrame does nothing.
+func (e *Encoder) EndFrame() error {
+	if err := e.EndLoop(); err != nil {
+		return err
+	}
+	if !e.inFrame {
+		return e.err
+	}
+	e.inFrame = false
+	e.tags = make(map[string]bool, 10)
+	e.w.frame, e.w.tag = "", ""
+	return e.do(func() { e.w.pf("save_\n") })
+}
+
+// Item writes a single data item. Any open table is ended first.
+func (e *Encoder) Item(tag string, v interface{}) error {
+	if err := e.EndLoop(); err != nil {
+		return err
+	}
+	if err := e.addTag(tag); err != nil {
+		return err
+	}
+	return e.do(func() {
+		e.w.checkLength("_" + tag)
+		e.w.writeValues([]string{"_" + tag, e.format(tag, v)},
+			e.w.itemSep(), e.w.width())
+	})
+}
+
+// BeginLoop starts a new table with the data tags given. Any open table is
+// ended first. At least one row must be written with Row before the table
+// is ended.
+func (e *Encoder) BeginLoop(tags ...string) error {
+	if err := e.EndLoop(); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return e.fail(WriteInvalidStructure,
+			"A table must have at least one data tag.")
+	}
+	for _, tag := range tags {
+		if err := e.addTag(tag); err != nil {
+			return err
+		}
+	}
+	e.loop = append([]string(nil), tags...)
+	e.rows = 0
+	return e.do(func() {
+		for _, tag := range tags {
+			e.w.tag = tag
+			e.w.checkLength("_" + tag)
+		}
+		e.w.tag = ""
+		e.w.pf("loop_\n")
+		for _, tag := range tags {
+			e.w.pf("_%s\n", tag)
+		}
+	})
+}
+
+// Row writes a single row of the current table. There must be exactly one
+// value for each data tag given to BeginLoop.
+func (e *Encoder) Row(values ...interface{}) error {
+	if e.loop == nil {
+		return e.fail(WriteInvalidStructure,
+			"A row must be written inside a table.")
+	}
+	if len(values) != len(e.loop) {
+		return e.fail(WriteRaggedLoop, "Table with data tag '%s' has %d "+
+			"columns, but a row with %d values was given.",
+			e.loop[0], len(e.loop), len(values))
+	}
+	e.rows++
+	return e.do(func() {
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = e.format(e.loop[i], v)
+		}
+		e.w.writeValues(row, e.w.loopSep(), e.w.width())
+	})
+}
+
+// EndLoop ends the current table. If there is no table, then EndLoop does
+// nothing.
+func (e *Encoder) EndLoop() error {
+	if e.loop == nil {
+		return e.err
+	}
+	tag := e.loop[0]
+	e.loop = nil
+	if e.rows == 0 {
+		return e.fail(WriteRaggedLoop, "Table with data tag '%s' has no rows.",
+			tag)
+	}
+	return e.err
+}
+
+// Close ends any open table or save frame and flushes all output to the
+// underlying io.Writer. Close does not close the underlying io.Writer.
+func (e *Encoder) Close() error {
+	if err := e.EndFrame(); err != nil {
+		return err
+	}
+	return e.do(func() {
+		if err := e.buf.Flush(); err != nil {
+			e.w.fail(WriteIO, err, "%s", err)
+		}
+	})
+}
+
+// addTag checks that tag is valid in the current block and records it.
+func (e *Encoder) addTag(tag string) error {
+	if !e.inBlock {
+		return e.fail(WriteInvalidStructure,
+			"Data tag '%s' must be written inside a data block.", tag)
+	}
+	e.w.tag = tag
+	if len(tag) == 0 || strings.IndexFunc(tag, isBlankChar) > -1 {
+		return e.fail(WriteInvalidStructure,
+			"Data tag '%s' is not a valid data tag.", tag)
+	}
+	if e.tags[strings.ToLower(tag)] {
+		return e.fail(WriteInvalidStructure,
+			"Data tag '%s' has already been written in this block.", tag)
+	}
+	e.tags[strings.ToLower(tag)] = true
+	return e.err
+}
+
+// addName checks the name of a data block or save frame, and records it in
+// the names already used.
+func (e *Encoder) addName(what, name string, used map[string]bool) error {
+	if len(name) == 0 || strings.IndexFunc(name, isBlankChar) > -1 {
+		return e.fail(WriteInvalidStructure,
+			"The %s name '%s' is not a valid name.", what, name)
+	}
+	if used[strings.ToLower(name)] {
+		return e.fail(WriteInvalidStructure,
+			"The %s '%s' has already been written.", what, name)
+	}
+	used[strings.ToLower(name)] = true
+	return e.err
+}
+
+// format formats a single value for the data tag given.
+func (e *Encoder) format(tag string, v interface{}) string {
+	e.w.tag = tag
+	tag = strings.ToLower(tag)
+	switch v := v.(type) {
+	case Value:
+		return e.w.valToStr(tag, v)
+	case string:
+		return e.w.formatStr(v)
+	case int:
+		return e.w.formatInt(v, "")
+	case float64:
+		return e.w.formatFloat(tag, v, "")
+	}
+	e.w.errf(WriteUnsupportedType,
+		"CIF does not support value of type '%T'.", v)
+	panic("unreachable")
+}
+
+func isBlankChar(r rune) bool {
+	return !isNonBlankChar(r)
+}
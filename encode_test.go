@@ -0,0 +1,196 @@
+package cif
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.Version("CIF_1.1")
+	enc.BeginBlock("1abc")
+	enc.Item("entry.id", "1ABC")
+	enc.Item("cell.length_a", 12.5)
+	enc.BeginLoop("atom_site.id", "atom_site.label", "atom_site.cartn_x")
+	for i := 0; i < 1000; i++ {
+		enc.Row(i+1, "C A", float64(i)/8)
+	}
+	enc.Item("struct.title", "a\nmulti-line title")
+	enc.BeginFrame("frame")
+	enc.Item("frame.id", AsValue("?"))
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cif, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cif.Version != "CIF_1.1" {
+		t.Fatalf("Expected version 'CIF_1.1' but got '%s'.", cif.Version)
+	}
+	block := cif.Blocks["1abc"]
+	if s := block.Items["struct.title"].String(); s != "a\nmulti-line title" {
+		t.Fatalf("Unexpected title '%s'.", s)
+	}
+	lp := block.Loops["atom_site.id"]
+	ids := lp.Get("atom_site.id").Ints()
+	xs := lp.Get("atom_site.cartn_x").Floats()
+	labels := lp.Get("atom_site.label").Strings()
+	if len(ids) != 1000 || len(xs) != 1000 || len(labels) != 1000 {
+		t.Fatalf("Expected 1000 rows, but got %d, %d and %d.",
+			len(ids), len(xs), len(labels))
+	}
+	if ids[999] != 1000 || xs[999] != 999.0/8 || labels[999] != "C A" {
+		t.Fatalf("Unexpected last row: %d %v %s",
+			ids[999], xs[999], labels[999])
+	}
+	if s := block.Frames["frame"].Items["frame.id"].String(); s != "?" {
+		t.Fatalf("Expected '?' in save frame, but got '%s'.", s)
+	}
+}
+
+func TestEncoderLineLength(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoderWith(buf, WriteOptions{MaxLineLength: 20})
+	enc.BeginBlock("long")
+	enc.Item("item", "a value of 19 chars")
+	enc.BeginLoop("a.x", "a.y", "a.z")
+	enc.Row("twelve chars", "twelve chars", "twelve chars")
+	enc.Row(1, 2, 3)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > 20 {
+			t.Fatalf("The line '%s' is longer than 20 characters:\n%s",
+				line, buf)
+		}
+	}
+	cif, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp := cif.Blocks["long"].Loops["a.x"]
+	if got := lp.Get("a.z").Strings(); got[0] != "twelve chars" {
+		t.Fatalf("Expected 'twelve chars' but got '%s'.", got[0])
+	}
+
+	long := strings.Repeat("t", 30)
+	for _, encode := range []func(enc *Encoder) error{
+		func(enc *Encoder) error { return enc.Item(long, 1) },
+		func(enc *Encoder) error { return enc.BeginLoop("a", long) },
+	} {
+		enc := NewEncoderWith(new(bytes.Buffer),
+			WriteOptions{MaxLineLength: 20})
+		enc.BeginBlock("long")
+		err := encode(enc)
+		werr, ok := err.(*WriteError)
+		if !ok || werr.Kind != WriteLineTooLong || werr.Tag != long {
+			t.Fatalf("Expected a line too long error for '%s', but got "+
+				"'%v'.", long, err)
+		}
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	tests := []struct {
+		encode func(enc *Encoder) error
+		err    string
+	}{
+		{
+			func(enc *Encoder) error { return enc.Item("a", 1) },
+			"inside a data block",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				enc.BeginLoop("a", "b")
+				return enc.Row(1)
+			},
+			"has 2 columns",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				enc.BeginLoop("a")
+				return enc.Close()
+			},
+			"has no rows",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				enc.Item("a", 1)
+				return enc.Item("A", 2)
+			},
+			"already been written",
+		},
+		{
+			func(enc *Encoder) error { return enc.BeginBlock("a b") },
+			"not a valid name",
+		},
+		{
+			func(enc *Encoder) error { return enc.BeginBlock("") },
+			"not a valid name",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				enc.Item("x", 1)
+				return enc.BeginBlock("A")
+			},
+			"data block 'A' has already been written",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				return enc.BeginFrame("f\tg")
+			},
+			"not a valid name",
+		},
+		{
+			func(enc *Encoder) error {
+				enc.BeginBlock("a")
+				enc.BeginFrame("f")
+				enc.Item("x", 1)
+				return enc.BeginFrame("F")
+			},
+			"save frame 'F' has already been written",
+		},
+	}
+	for _, test := range tests {
+		err := test.encode(NewEncoder(new(bytes.Buffer)))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("Expected error containing '%s', but got '%v'.",
+				test.err, err)
+		}
+		if _, ok := err.(*WriteError); !ok {
+			t.Fatalf("Expected a *WriteError but got %T.", err)
+		}
+	}
+
+	kinds := []struct {
+		v    interface{}
+		kind WriteErrorKind
+	}{
+		{"café", WriteInvalidChar},
+		{math.Inf(1), WriteInvalidValue},
+		{[]int{1}, WriteUnsupportedType},
+	}
+	for _, test := range kinds {
+		enc := NewEncoder(new(bytes.Buffer))
+		enc.BeginBlock("errors")
+		err := enc.Item("bad", test.v)
+		werr, ok := err.(*WriteError)
+		if !ok || werr.Kind != test.kind || werr.Tag != "bad" ||
+			werr.Block != "errors" {
+
+			t.Fatalf("Expected a '%s' error for tag 'bad' in block "+
+				"'errors', but got: %v", test.kind, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package cif
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matchJSONNumber matches every number in JSON syntax.
+var matchJSONNumber = regexp.MustCompile(
+	"^-?(0|[1-9][0-9]*)(\\.[0-9]+)?([eE][+-]?[0-9]+)?$")
+
+// The schema of the CIF-JSON written by WriteJSON.
+const (
+	jsonSchemaName    = "CIF-JSON"
+	jsonSchemaVersion = "1.0.0"
+	jsonSchemaURI     = "http://www.iucr.org/resources/cif/cif-json.json"
+)
+
+type jsonWriter struct {
+	*writer
+	buf *bytes.Buffer
+}
+
+// WriteJSON writes an existing CIF to the writer given as CIF-JSON, the
+// IUCr's standard representation of CIF data in JSON, which is described at
+// https://www.iucr.org/resources/cif/cif-json. The JSON is written without
+// any whitespace, followed by a new line.
+//
+// The JSON has a single member, "CIF-JSON", which contains the "Metadata"
+// of the schema and a member for each data block. Each data block is an
+// object with a member for each data tag (with its leading underscore),
+// whose value is an array of the tag's values: a single value for data
+// items not in a table, and a value for each row of a table otherwise. The
+// save frames of a data block (if any) are in its "Frames" member, in the
+// same form as data blocks. The "cif-version" of the metadata is "2.0" if the
+// CIF's Version is "CIF_2.0", and "1.1" otherwise. (As with Write, CIF 2.0
+// lists and tables cannot be written.)
+//
+// Missing values ("?") are written as null and omitted values (".") are
+// written as false, as the specification requires. Strings are JSON
+// strings. Since a CIF read with Read does not record whether a value was
+// quoted, the quoted strings '?' and '.' are also written as null and false.
+//
+// Numbers are JSON numbers written with their original text (when it still
+// corresponds to their value), so that no digits are lost. A text that isn't
+// a JSON number (like "+3" or ".5") is rewritten with the same digits in
+// JSON syntax (like 3 and 0.5). Numbers with a standard uncertainty in
+// parentheses are written as strings of their text (like "1.23(4)"), which
+// the specification also requires.
+//
+// Data blocks, save frames and data tags are written in the same order as
+// Write writes them, so the output is deterministic.
+//
+// Before anything is written, the CIF is checked with Validate. If there are
+// any problems, then nothing is written and the problems are returned as
+// ValidationErrors. Otherwise, any error returned has type *WriteError.
+func (cif *CIF) WriteJSON(w io.Writer) error {
+	if err := cif.Validate(); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	jw := &jsonWriter{writer: &writer{CIF: cif, w: buf}, buf: buf}
+	if err := jw.write(); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	if _, err := buf.WriteTo(w); err != nil {
+		return &WriteError{Kind: WriteIO, Err: err, msg: err.Error()}
+	}
+	return nil
+}
+
+func (w *jsonWriter) write() (err error) {
+	defer w.recover(&err)
+	version := "1.1"
+	if w.Version == "CIF_2.0" {
+		version = "2.0"
+	}
+	w.buf.WriteString(`{"CIF-JSON":{"Metadata":{`)
+	w.buf.WriteString(`"cif-version":` + jsonString(version))
+	w.buf.WriteString(`,"schema-name":` + jsonString(jsonSchemaName))
+	w.buf.WriteString(`,"schema-version":` + jsonString(jsonSchemaVersion))
+	w.buf.WriteString(`,"schema-uri":` + jsonString(jsonSchemaURI) + "}")
+
+	names := make([]string, 0, len(w.Blocks))
+	for name := range w.Blocks {
+		names = append(names, name)
+	}
+	for _, name := range ordered(w.order, names, lessString) {
+		b := w.Blocks[name]
+		w.block, w.frame, w.tag = b.Name, "", ""
+		w.buf.WriteString("," + jsonString(b.Name) + ":{")
+		comma := w.writeBlock(&b.Block)
+
+		frames := make([]string, 0, len(b.Frames))
+		for name := range b.Frames {
+			frames = append(frames, name)
+		}
+		for i, name := range ordered(b.frameOrder, frames, lessString) {
+			if i == 0 {
+				if comma {
+					w.buf.WriteByte(',')
+				}
+				w.buf.WriteString(`"Frames":{`)
+			} else {
+				w.buf.WriteByte(',')
+			}
+			w.frame = b.Frames[name].Name
+			w.buf.WriteString(jsonString(w.frame) + ":{")
+			w.writeBlock(&b.Frames[name].Block)
+			w.buf.WriteByte('}')
+		}
+		if len(frames) > 0 {
+			w.buf.WriteByte('}')
+		}
+		w.frame = ""
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteString("}}")
+	return nil
+}
+
+// writeBlock writes the members of a data block or save frame for each of
+// its data tags, and returns true if any were written.
+func (w *jsonWriter) writeBlock(b *Block) bool {
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+	for i, tag := range ordered(b.order, tags, lessTag) {
+		w.tag = tag
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.buf.WriteString(jsonString("_"+tag) + ":[")
+		if val, ok := b.Items[tag]; ok {
+			w.writeValue(val)
+		} else {
+			w.writeColumn(b.Loops[tag].Get(tag))
+		}
+		w.buf.WriteByte(']')
+	}
+	w.tag = ""
+	return len(tags) > 0
+}
+
+// writeColumn writes the values of a column in a table, separated by commas.
+func (w *jsonWriter) writeColumn(col ValueLoop) {
+	texts := columnTexts(col)
+	switch raw := col.Raw().(type) {
+	case []string:
+		for i, s := range raw {
+			w.comma(i)
+			w.writeString(s)
+		}
+	case []int:
+		for i, n := range raw {
+			w.comma(i)
+			w.writeInt(n, textAt(texts, i))
+		}
+	case []float64:
+		for i, f := range raw {
+			w.comma(i)
+			w.writeFloat(f, textAt(texts, i))
+		}
+	default:
+		w.errf(WriteUnsupportedType,
+			"CIF-JSON does not support a column of type '%T'.", raw)
+	}
+}
+
+// comma writes a comma before every value but the first.
+func (w *jsonWriter) comma(i int) {
+	if i > 0 {
+		w.buf.WriteByte(',')
+	}
+}
+
+// writeValue writes a single value.
+func (w *jsonWriter) writeValue(v Value) {
+	switch raw := v.Raw().(type) {
+	case string:
+		w.writeString(raw)
+	case int:
+		w.writeInt(raw, Text(v))
+	case float64:
+		w.writeFloat(raw, Text(v))
+	default:
+		w.errf(WriteUnsupportedType,
+			"CIF-JSON does not support a value of type '%T'.", raw)
+	}
+}
+
+// writeString writes a string, or null or false for missing and omitted
+// values.
+func (w *jsonWriter) writeString(s string) {
+	switch s {
+	case "?":
+		w.buf.WriteString("null")
+	case ".":
+		w.buf.WriteString("false")
+	default:
+		w.buf.WriteString(jsonString(s))
+	}
+}
+
+// writeInt writes an integer using its original text if that text still
+// corresponds to n.
+func (w *jsonWriter) writeInt(n int, text string) {
+	if isNullText(text) && n == 0 {
+		w.writeString(text)
+		return
+	}
+	num := trimUncertainty(text)
+	if m, err := strconv.Atoi(num); err == nil && m == n && num != text {
+		w.buf.WriteString(jsonString(text))
+		return
+	}
+	w.buf.WriteString(jsonNumber(w.formatInt(n, text)))
+}
+
+// writeFloat writes a float using its original text if that text still
+// corresponds to f, or with the shortest representation that reads back as
+// exactly f.
+func (w *jsonWriter) writeFloat(f float64, text string) {
+	if isNullText(text) && f == 0 {
+		w.writeString(text)
+		return
+	}
+	num := trimUncertainty(text)
+	if g, err := strconv.ParseFloat(num, 64); err == nil && g == f &&
+		num != text {
+
+		w.buf.WriteString(jsonString(text))
+		return
+	}
+	w.buf.WriteString(jsonNumber(w.formatFloat(w.tag, f, text)))
+}
+
+// jsonNumber returns a number in CIF syntax (see matchNumeric) with the same
+// digits in JSON syntax. e.g., "+.50" becomes "0.50" and "1.e" becomes "1".
+func jsonNumber(s string) string {
+	if matchJSONNumber.MatchString(s) {
+		return s
+	}
+	mant, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i > -1 {
+		mant, exp = s[:i], s[i:]
+	}
+	sign := ""
+	if strings.HasPrefix(mant, "-") {
+		sign = "-"
+	}
+	mant = strings.TrimLeft(mant, "+-")
+	whole, frac := mant, ""
+	if i := strings.IndexByte(mant, '.'); i > -1 {
+		whole, frac = mant[:i], mant[i+1:]
+	}
+	if whole = strings.TrimLeft(whole, "0"); len(whole) == 0 {
+		whole = "0"
+	}
+	num := sign + whole
+	if len(frac) > 0 {
+		num += "." + frac
+	}
+	if len(strings.TrimLeft(exp, "eE+-")) > 0 {
+		num += exp
+	}
+	return num
+}
+
+// jsonString returns a string in JSON syntax.
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
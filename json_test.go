@@ -0,0 +1,81 @@
+package cif
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	data := `#\#CIF_1.1
+data_Test
+_cell.length_a 10.500
+_cell.length_b 1.23(4)
+_cell.z +3
+_cell.angle .5E+2
+_cell.note 'a "<b>" & c'
+_cell.details ?
+_cell.method .
+loop_
+_atom.id
+_atom.x
+_atom.label
+_atom.n
+1 1.500 'C 1' 007
+2 . ? .
+3 -0.25 'C 3' 3
+save_frame
+_frame.id f
+save_
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := cif.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"CIF-JSON":{"Metadata":{"cif-version":"1.1",` +
+		`"schema-name":"CIF-JSON","schema-version":"1.0.0",` +
+		`"schema-uri":"http://www.iucr.org/resources/cif/cif-json.json"},` +
+		`"test":{"_cell.length_a":[10.500],"_cell.length_b":["1.23(4)"],` +
+		`"_cell.z":[3],"_cell.angle":[0.5E+2],` +
+		`"_cell.note":["a \"<b>\" & c"],"_cell.details":[null],` +
+		`"_cell.method":[false],"_atom.id":[1,2,3],` +
+		`"_atom.x":[1.500,false,-0.25],"_atom.label":["C 1",null,"C 3"],` +
+		`"_atom.n":[7,false,3],` +
+		`"Frames":{"frame":{"_frame.id":["f"]}}}}}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("CIF-JSON should be\n%s\nbut is\n%s", want, buf.String())
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("CIF-JSON is not valid JSON.")
+	}
+
+	// Values created after reading are written exactly.
+	b := cif.Blocks["test"]
+	b.Items["cell.length_a"] = AsValue(1e-7)
+	b.Items["cell.z"] = AsValue(4)
+	b.Items["cell.note"] = AsValue("two\nlines")
+	delete(b.Frames, "frame")
+	buf.Reset()
+	if err := cif.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`"_cell.length_a":[0.0000001]`, `"_cell.z":[4]`,
+		`"_cell.note":["two\nlines"]`, `"_atom.n":[7,false,3]}}}`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("CIF-JSON should contain %s:\n%s", s, buf.String())
+		}
+	}
+
+	b.Items["cell.length_a"] = AsValue(math.Inf(1))
+	if err := cif.WriteJSON(new(bytes.Buffer)); err == nil {
+		t.Fatalf("Writing an infinite float should fail.")
+	}
+}
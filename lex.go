@@ -21,6 +21,11 @@ const (
 	itemDataInteger
 	itemDataFloat
 	itemDataString
+	itemListStart
+	itemListEnd
+	itemTableStart
+	itemTableEnd
+	itemTableKey
 	itemDataNone // used in parser to indicate no type
 )
 
@@ -252,11 +257,12 @@ func (lx *lexer) chars(oneOrMore bool, predFn func(rune) bool) stateFn {
 	return lexPred
 }
 
-// lexVersion attempts to lex the first 11 bytes as the string "#\#CIF_1.1".
-// If it fails, it drops into a regular comment.
+// lexVersion attempts to lex the first 11 bytes as the string "#\#CIF_1.1"
+// or "#\#CIF_2.0". If it fails, it drops into a regular comment. If the
+// version is 2.0, then the rest of the input is lexed as CIF 2.0.
 // This assumes that the initial '#' has already been consumed.
 func lexVersion(lx *lexer) stateFn {
-	letters := []rune{'\\', '#', 'C', 'I', 'F', '_', '1', '.', '1'}
+	letters := []rune{'\\', '#', 'C', 'I', 'F', '_'}
 	for _, letter := range letters {
 		r := lx.next()
 		if r != letter {
@@ -264,6 +270,18 @@ func lexVersion(lx *lexer) stateFn {
 			return lexComment
 		}
 	}
+	switch {
+	case lx.aheadMatch("1.1"):
+	case lx.aheadMatch("2.0"):
+		lx.cif2 = true
+		lx.unquotedChar, lx.textChar = isUnquotedChar2, isTextChar2
+	default:
+		lx.push(lexCif)
+		return lexComment
+	}
+	lx.next()
+	lx.next()
+	lx.next()
 	lx.emit(itemVersion)
 	return lexCif
 }
@@ -280,7 +298,7 @@ func lexSpaceOrEof(lx *lexer, next stateFn) stateFn {
 
 func lexSpaceOrEofContinue(lx *lexer) stateFn {
 	r := lx.peek()
-	if !isWhiteSpace(r) && r != eof {
+	if !isWhiteSpace(r) && r != eof && !lx.isCloser(r) {
 		return lx.errf("Expected whitespace or EOF, "+"but got '%s' "+
 			"instead.", r)
 	} else if r == eof {
@@ -397,6 +415,16 @@ func (itype itemType) String() string {
 		return "DataFloat"
 	case itemDataString:
 		return "DataString"
+	case itemListStart:
+		return "ListStart"
+	case itemListEnd:
+		return "ListEnd"
+	case itemTableStart:
+		return "TableStart"
+	case itemTableEnd:
+		return "TableEnd"
+	case itemTableKey:
+		return "TableKey"
 	}
 	panic(sf("BUG: Unknown type '%s'.", itype))
 }
@@ -0,0 +1,191 @@
+package cif
+
+import "strings"
+
+// This file contains the parts of the lexer that are specific to CIF 2.0:
+// triple-quoted strings, lists and tables. They are only used when the input
+// starts with the version annotation "#\#CIF_2.0".
+//
+// Lists are delimited by '[' and ']' and contain zero or more values
+// separated by whitespace. Tables are delimited by '{' and '}' and contain
+// zero or more entries separated by whitespace, where each entry is a quoted
+// key, immediately followed by a ':', optional whitespace and a value. Lists
+// and tables may be nested.
+//
+// In CIF 2.0, a quoted string ends at the first matching quote (regardless
+// of what follows it), and unquoted strings may not contain any of the list
+// or table delimiters.
+
+// lexValue2 consumes the start of the values that are specific to CIF 2.0,
+// given the first character of the value. It returns false if the value is
+// not one of them.
+func lexValue2(lx *lexer, r rune) (stateFn, bool) {
+	switch {
+	case (r == '\'' || r == '"') && lx.aheadMatch(string([]rune{r, r})):
+		lx.next()
+		lx.next()
+		lx.ignore()
+		return lexValueTripleQuoted(r), true
+	case r == '\'' || r == '"':
+		lx.ignore()
+		return lexValueQuoted2(r), true
+	case r == '[':
+		lx.nesting = append(lx.nesting, r)
+		lx.emit(itemListStart)
+		return lexContainerNext, true
+	case r == '{':
+		lx.nesting = append(lx.nesting, r)
+		lx.emit(itemTableStart)
+		return lexContainerNext, true
+	case r == ']' || r == '}':
+		return lx.errf("Unexpected '%s' outside of a list or table.", r), true
+	case r >= 0x80:
+		lx.push(lexValueUnquotedEnd)
+		return lx.chars(false, lx.unquotedChar), true
+	}
+	return nil, false
+}
+
+// lexValueQuoted2 consumes a quoted string in CIF 2.0, which ends at the
+// first matching quote.
+func lexValueQuoted2(quote rune) stateFn {
+	return func(lx *lexer) stateFn {
+		for {
+			r := lx.next()
+			if isNL(r) {
+				return lx.errf("Quoted strings may not contain new lines.")
+			}
+			if r == eof {
+				return lx.errf("Expected end of quoted string, but got EOF.")
+			}
+			if r == quote {
+				lx.backup()
+				lx.emit(itemDataString)
+				lx.accept(r)
+				lx.ignore()
+				return lexSpaceOrEof(lx, lexValueEnd)
+			}
+		}
+	}
+}
+
+// lexValueTripleQuoted consumes a string delimited by three quotes, which
+// may span several lines. This assumes the opening quotes have already been
+// consumed (and ignored).
+func lexValueTripleQuoted(quote rune) stateFn {
+	return func(lx *lexer) stateFn {
+		delim := strings.Repeat(string(quote), 3)
+		for !lx.aheadMatch(delim) {
+			if lx.next() == eof {
+				return lx.errf("Expected end of triple-quoted string, but " +
+					"got EOF.")
+			}
+		}
+		lx.emit(itemDataString)
+		return lx.acceptStr(delim, lexSpaceOrEof(lx, lexValueEnd))
+	}
+}
+
+// lexContainerNext consumes optional whitespace inside a list or table, and
+// then looks for the next value (or entry) or the end of the list or table.
+func lexContainerNext(lx *lexer) stateFn {
+	lx.push(lexContainerItem)
+	return lexWhiteSpaceContinue
+}
+
+// lexContainerItem consumes the end of the current list or table, or else
+// starts consuming its next value (or entry).
+func lexContainerItem(lx *lexer) stateFn {
+	open := lx.nesting[len(lx.nesting)-1]
+	r := lx.peek()
+	switch {
+	case r == eof:
+		return lx.errf("Expected a value or the end of a list or table, but " +
+			"got EOF.")
+	case r == ']' || r == '}':
+		if (open == '[') != (r == ']') {
+			return lx.errf("Unexpected '%s' in a list or table started with "+
+				"'%s'.", r, open)
+		}
+		lx.next()
+		lx.nesting = lx.nesting[:len(lx.nesting)-1]
+		if r == ']' {
+			lx.emit(itemListEnd)
+		} else {
+			lx.emit(itemTableEnd)
+		}
+		return lexSpaceOrEof(lx, lexValueEnd)
+	case open == '{':
+		return lexTableKey
+	}
+	lx.push(lexContainerNext)
+	return lexValue
+}
+
+// lexTableKey consumes the quoted key of a table entry, which must be
+// immediately followed by a ':'.
+func lexTableKey(lx *lexer) stateFn {
+	r := lx.next()
+	if r != '\'' && r != '"' {
+		return lx.errf("Expected a quoted table key, but got '%s' instead.", r)
+	}
+	delim := string(r)
+	if lx.aheadMatch(delim + delim) {
+		lx.next()
+		lx.next()
+		delim = strings.Repeat(delim, 3)
+	}
+	lx.ignore()
+	for !lx.aheadMatch(delim) {
+		r := lx.next()
+		if r == eof {
+			return lx.errf("Expected end of table key, but got EOF.")
+		}
+		if isNL(r) && len(delim) == 1 {
+			return lx.errf("Quoted strings may not contain new lines.")
+		}
+	}
+	lx.emit(itemTableKey)
+	return lx.acceptStr(delim, lexTableColon)
+}
+
+// lexTableColon consumes the ':' after a table key, and then the value of
+// the entry.
+func lexTableColon(lx *lexer) stateFn {
+	if !lx.accept(':') {
+		return lx.errf("Expected ':' after a table key, but got '%s' "+
+			"instead.", lx.peek())
+	}
+	lx.ignore()
+	lx.push(lexContainerNext)
+	lx.push(lexValue)
+	return lexWhiteSpaceContinue
+}
+
+// isValueEnd returns true if r may follow a value: whitespace, EOF or (inside
+// a list or table) the end of a list or table.
+func (lx *lexer) isValueEnd(r rune) bool {
+	return isWhiteSpace(r) || r == eof || lx.isCloser(r)
+}
+
+// isCloser returns true if r ends a list or table, and a list or table is
+// currently being lexed.
+func (lx *lexer) isCloser(r rune) bool {
+	return len(lx.nesting) > 0 && (r == ']' || r == '}')
+}
+
+// isUnquotedChar2 returns true if r may appear in an unquoted string in CIF
+// 2.0. This excludes the list and table delimiters, but includes every byte
+// of a non-ASCII (UTF-8) character.
+func isUnquotedChar2(r rune) bool {
+	if r == '[' || r == ']' || r == '{' || r == '}' {
+		return false
+	}
+	return isNonBlankChar(r) || r >= 0x80
+}
+
+// isTextChar2 returns true if r may appear in a text field in CIF 2.0. This
+// includes every byte of a non-ASCII (UTF-8) character.
+func isTextChar2(r rune) bool {
+	return isPrintChar(r) || r >= 0x80
+}
@@ -32,3 +32,18 @@ func TestLexer(t *testing.T) {
 		pf("%s :: %s\n", item.typ, item.val)
 	}
 }
+
+func TestLexerError(t *testing.T) {
+	lx := lex("data_x\n_a 'unterminated\n")
+	for {
+		item := lx.nextItem()
+		if item.typ == itemEOF {
+			t.Fatalf("Expected an error, but got EOF.")
+		} else if item.typ == itemError {
+			break
+		}
+	}
+	if item := lx.nextItem(); item.typ != itemEOF {
+		t.Fatalf("Expected EOF after an error, but got '%s'.", item.val)
+	}
+}
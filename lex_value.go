@@ -21,8 +21,13 @@ func lexValue(lx *lexer) stateFn {
 	// }
 
 	r := lx.next()
+	if lx.cif2 {
+		if next, ok := lexValue2(lx, r); ok {
+			return next
+		}
+	}
 	switch {
-	case r == dataOmitted && (isWhiteSpace(lx.peek()) || lx.peek() == eof):
+	case r == dataOmitted && lx.isValueEnd(lx.peek()):
 		lx.emit(itemDataOmitted)
 		return lexSpaceOrEof(lx, lexValueEnd)
 	case r == dataMissing:
@@ -42,10 +47,10 @@ func lexValue(lx *lexer) stateFn {
 		return lexValueTextFieldFirstLine
 	case isNL(previous) && isOrdinaryChar(r):
 		lx.push(lexValueUnquotedEnd)
-		return lx.chars(false, isNonBlankChar)
+		return lx.chars(false, lx.unquotedChar)
 	case !isNL(previous) && (isOrdinaryChar(r) || r == ';'):
 		lx.push(lexValueUnquotedEnd)
-		return lx.chars(false, isNonBlankChar)
+		return lx.chars(false, lx.unquotedChar)
 	}
 	return lx.errf("Expected a value ('.', '?', numeric or string), "+
 		"but got '%s'.", r)
@@ -54,6 +59,9 @@ func lexValue(lx *lexer) stateFn {
 // lexValueEnd ensures there is whitespace after a value and returns to the
 // next state on the stack.
 func lexValueEnd(lx *lexer) stateFn {
+	if lx.isCloser(lx.peek()) {
+		return lx.pop()
+	}
 	return lexWhiteSpace(lx, lx.pop())
 }
 
@@ -71,7 +79,7 @@ func lexValueIntegerStart(lx *lexer) stateFn {
 	}
 	// Fall back to unquoted string.
 	lx.push(lexValueUnquotedEnd)
-	return lx.chars(false, isNonBlankChar)
+	return lx.chars(false, lx.unquotedChar)
 }
 
 // lexValueInteger tries to consume an integer while allowing for the
@@ -89,13 +97,13 @@ func lexValueInteger(lx *lexer) stateFn {
 	case r == 'e' || r == 'E':
 		lx.accept(r)
 		return lexValueExponentFirst
-	case isWhiteSpace(r) || r == eof:
+	case lx.isValueEnd(r):
 		lx.emit(itemDataInteger)
 		return lexSpaceOrEof(lx, lexValueEnd)
 	}
 	// Fall back to unquoted string.
 	lx.push(lexValueUnquotedEnd)
-	return lx.chars(false, isNonBlankChar)
+	return lx.chars(false, lx.unquotedChar)
 }
 
 // lexValueExponentFirst checks for a '+' or '-' before any digits in an
@@ -115,13 +123,13 @@ func lexValueExponent(lx *lexer) stateFn {
 	case isDigit(r):
 		lx.accept(r)
 		return lexValueExponent
-	case isWhiteSpace(r) || r == eof:
+	case lx.isValueEnd(r):
 		lx.emit(itemDataFloat)
 		return lexSpaceOrEof(lx, lexValueEnd)
 	}
 	// Fall back to unquoted string.
 	lx.push(lexValueUnquotedEnd)
-	return lx.chars(false, isNonBlankChar)
+	return lx.chars(false, lx.unquotedChar)
 }
 
 // lexValueExponentEnd emits the value as a float.
@@ -141,13 +149,13 @@ func lexValueFloatAfterDecimal(lx *lexer) stateFn {
 	case r == 'e' || r == 'E':
 		lx.accept(r)
 		return lexValueExponentFirst
-	case isWhiteSpace(r) || r == eof:
+	case lx.isValueEnd(r):
 		lx.emit(itemDataFloat)
 		return lexSpaceOrEof(lx, lexValueEnd)
 	}
 	// Fall back to unquoted string.
 	lx.push(lexValueUnquotedEnd)
-	return lx.chars(false, isNonBlankChar)
+	return lx.chars(false, lx.unquotedChar)
 }
 
 // lexValueTextField assumes that '<eol>;' has already been consumed (and
@@ -156,7 +164,7 @@ func lexValueFloatAfterDecimal(lx *lexer) stateFn {
 // subsequent lines may not begin with a ';'.
 func lexValueTextFieldFirstLine(lx *lexer) stateFn {
 	lx.push(lexValueTextField)
-	return lx.chars(false, isPrintChar)
+	return lx.chars(false, lx.textChar)
 }
 
 // lexValueTextField assumes that the first line of a semi-colon text field
@@ -165,7 +173,7 @@ func lexValueTextFieldFirstLine(lx *lexer) stateFn {
 func lexValueTextField(lx *lexer) stateFn {
 	s := lx.peekAt(2)
 	if len(s) == 2 && isNL(rune(s[0])) && s[1] == ';' {
-		lx.emit(itemDataString)
+		lx.emitTextField()
 		return lx.acceptStr(s, lexSpaceOrEof(lx, lexValueEnd))
 	}
 	if len(s) < 2 {
@@ -183,7 +191,7 @@ func lexValueTextField(lx *lexer) stateFn {
 		return lexValueTextField
 	}
 	lx.push(lexValueTextField)
-	return lx.chars(true, isPrintChar)
+	return lx.chars(true, lx.textChar)
 }
 
 // lexValueUnquotedEnd emits the value as a string. It also makes sure that
@@ -23,6 +23,19 @@ type lexer struct {
 	// The last state on the stack is used after a value has
 	// been lexed. Similarly for comments.
 	stack []stateFn
+
+	// cif2 is true when the input declares itself as CIF 2.0, which permits
+	// lists, tables and triple-quoted strings.
+	cif2 bool
+
+	// unquotedChar and textChar are the predicates for characters permitted
+	// in unquoted strings and text fields, respectively. They depend on the
+	// version of CIF being lexed.
+	unquotedChar, textChar func(rune) bool
+
+	// nesting is a stack of the opening delimiters ('[' or '{') of the CIF
+	// 2.0 lists and tables currently being lexed.
+	nesting []rune
 }
 
 type item struct {
@@ -38,15 +51,21 @@ func lex(input string) *lexer {
 		line:    1,
 		emitted: nil,
 		stack:   make([]stateFn, 0, 10),
+
+		unquotedChar: isNonBlankChar,
+		textChar:     isPrintChar,
 	}
 	return lx
 }
 
+// nextItem returns the next item. When the lexer stops, the item emitted by
+// its last state (an itemError or itemEOF) is returned, so that errors are
+// not reported as the end of the input. After that, itemEOF is returned.
 func (lx *lexer) nextItem() (it item) {
 	for lx.emitted == nil && lx.state != nil {
 		lx.state = lx.state(lx)
 	}
-	if lx.state == nil {
+	if lx.emitted == nil {
 		return item{itemEOF, "", 0}
 	}
 	it, lx.emitted = *lx.emitted, nil
@@ -83,6 +102,14 @@ func (lx *lexer) emit(typ itemType) {
 	lx.start = lx.pos
 }
 
+// emitTextField emits the consumed input as the contents of a semi-colon text
+// field. If the text field uses the line folding or text prefix protocols,
+// then they are undone.
+func (lx *lexer) emitTextField() {
+	lx.emit(itemDataString)
+	lx.emitted.val = decodeTextField(lx.emitted.val)
+}
+
 func (lx *lexer) next() (r rune) {
 	if lx.pos >= len(lx.input) {
 		lx.width = 0
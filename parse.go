@@ -12,6 +12,9 @@ type parser struct {
 	*CIF
 	lx   *lexer
 	line int
+
+	// dict, when not nil, determines the types of values.
+	dict *Dictionary
 }
 
 type cifError string
@@ -22,7 +25,39 @@ func (ce cifError) Error() string {
 
 // Read reads CIF formatted input and returns a CIF value if and only if the
 // input conforms to the CIF 1.1 specification.
+//
+// The type of each value (string, int or float64) is inferred from how it
+// is written. For a table, a column is only numeric if every value in it is.
+// To use the types declared in a dictionary instead, use ReadWith.
 func Read(r io.Reader) (*CIF, error) {
+	return ReadWith(r, ReadOptions{})
+}
+
+// ReadOptions controls how CIF data is read. The zero value of ReadOptions
+// corresponds to the behavior of Read.
+type ReadOptions struct {
+	// Dictionary, when not nil, determines the type of every value of a data
+	// tag defined in it, regardless of how the value is written. This makes
+	// the type of a data tag the same in every file. e.g., a chain ID of
+	// "1" is still a string, and a column of residue numbers is always
+	// []int.
+	//
+	// Data tags with an integer type ("int", "positive_int", "integer",
+	// "count" or "index") have int values, data tags with a floating point
+	// type ("float", "real" or DDL1's "numb") have float64 values and all
+	// other data tags have string values. Omitted and missing values in
+	// numeric columns are 0 (see Texts). A number may have a standard
+	// uncertainty in parentheses, e.g., "1.23(4)", which is ignored for its
+	// numeric value.
+	//
+	// If a value of a numeric data tag is not a number, then reading fails.
+	// Data tags that are not in the dictionary have their types inferred as
+	// with Read.
+	Dictionary *Dictionary
+}
+
+// ReadWith is like Read, except it reads according to the options given.
+func ReadWith(r io.Reader, opts ReadOptions) (*CIF, error) {
 	cif := &CIF{
 		Version: "",
 		Blocks:  make(map[string]*DataBlock, 10),
@@ -31,7 +66,7 @@ func Read(r io.Reader) (*CIF, error) {
 	if err != nil {
 		return nil, err
 	}
-	return (&parser{CIF: cif}).parse(string(input))
+	return (&parser{CIF: cif, dict: opts.Dictionary}).parse(string(input))
 }
 
 func (p *parser) errf(format string, v ...interface{}) {
@@ -91,6 +126,7 @@ func (p *parser) parseDataBlock(name string) item {
 		Frames: make(map[string]*SaveFrame, 0), // only used for dictionaries
 	}
 	p.Blocks[name] = dblock
+	p.order = append(p.order, name)
 	for t := p.next(); ; {
 		switch t.typ {
 		case itemEOF, itemDataBlockStart:
@@ -99,9 +135,9 @@ func (p *parser) parseDataBlock(name string) item {
 			p.parseSaveFrame(dblock, strings.ToLower(t.val))
 			t = p.next()
 		case itemLoop:
-			t = p.parseLoop(dblock.Block)
+			t = p.parseLoop(&dblock.Block)
 		case itemDataTag:
-			p.parseItemValue(dblock.Block, strings.ToLower(t.val))
+			p.parseItemValue(&dblock.Block, strings.ToLower(t.val))
 			t = p.next()
 		default:
 			p.errf("Expected comments, whitespace or a data block heading, "+
@@ -124,14 +160,15 @@ func (p *parser) parseSaveFrame(dblock *DataBlock, name string) {
 		},
 	}
 	dblock.Frames[name] = frame
+	dblock.frameOrder = append(dblock.frameOrder, name)
 	for t := p.next(); ; {
 		switch t.typ {
 		case itemSaveFrameEnd:
 			return
 		case itemLoop:
-			t = p.parseLoop(frame.Block)
+			t = p.parseLoop(&frame.Block)
 		case itemDataTag:
-			p.parseItemValue(frame.Block, strings.ToLower(t.val))
+			p.parseItemValue(&frame.Block, strings.ToLower(t.val))
 			t = p.next()
 		default:
 			p.errf("Expected a data item or end of save frame delimiter, "+
@@ -140,9 +177,15 @@ func (p *parser) parseSaveFrame(dblock *DataBlock, name string) {
 	}
 }
 
-func (p *parser) parseItemValue(b Block, name string) {
+func (p *parser) parseItemValue(b *Block, name string) {
 	p.assertUniqueTag(b, name)
-	b.Items[name] = p.parseValue(p.next(), b.Name, name)
+	t := p.next()
+	if typ := p.dictType(name); typ != itemDataNone && isScalar(t.typ) {
+		b.Items[name] = p.typedValue(name, typ, t)
+	} else {
+		b.Items[name] = p.parseValue(t, b.Name, name)
+	}
+	b.order = append(b.order, name)
 }
 
 func (p *parser) parseValue(t item, bname, name string) Value {
@@ -156,15 +199,19 @@ func (p *parser) parseValue(t item, bname, name string) Value {
 		if err != nil {
 			p.errf("Could not parse '%s' as integer: %s", t.val, err)
 		}
-		return AsValue(n)
+		return cifInt{n: n, text: t.val}
 	case itemDataFloat:
 		f, err := strconv.ParseFloat(t.val, 64)
 		if err != nil {
 			p.errf("Could not parse '%s' as float: %s", t.val, err)
 		}
-		return AsValue(f)
+		return cifFloat{f: f, text: t.val}
 	case itemDataString:
 		return AsValue(t.val)
+	case itemListStart:
+		return p.parseList(bname, name)
+	case itemTableStart:
+		return p.parseTable(bname, name)
 	default:
 		p.errf("Expected value for data tag '%s' in block '%s', but got a "+
 			"'%s' instead.", name, bname, t.typ)
@@ -172,7 +219,96 @@ func (p *parser) parseValue(t item, bname, name string) Value {
 	panic("unreachable")
 }
 
-func (p *parser) assertUniqueTag(b Block, name string) {
+// typedValue returns the value of a data item with the type declared for
+// it in the dictionary (see dictType). Omitted and missing values are
+// returned as strings, as usual.
+func (p *parser) typedValue(name string, typ itemType, t item) Value {
+	switch {
+	case isNull(t.typ):
+		return AsValue(t.val)
+	case typ == itemDataInteger:
+		n, err := strconv.Atoi(trimUncertainty(t.val))
+		if err != nil {
+			p.errf("Could not parse '%s' as integer for data tag '%s': %s",
+				t.val, name, err)
+		}
+		return cifInt{n: n, text: t.val}
+	case typ == itemDataFloat:
+		f, err := strconv.ParseFloat(trimUncertainty(t.val), 64)
+		if err != nil {
+			p.errf("Could not parse '%s' as float for data tag '%s': %s",
+				t.val, name, err)
+		}
+		return cifFloat{f: f, text: t.val}
+	}
+	return cifString(t.val)
+}
+
+// dictType returns the type declared for the data tag given in the
+// dictionary: itemDataInteger, itemDataFloat or itemDataString. If there is
+// no dictionary, or the data tag is not defined in it, then itemDataNone is
+// returned.
+func (p *parser) dictType(name string) itemType {
+	if p.dict == nil {
+		return itemDataNone
+	}
+	item := p.dict.Items[name]
+	if item == nil {
+		return itemDataNone
+	}
+	return itemKind(item)
+}
+
+// itemKind returns the type of the values of a data item, as described for
+// ReadOptions: itemDataInteger, itemDataFloat or itemDataString.
+func itemKind(item *ItemDef) itemType {
+	switch item.Type {
+	case "int", "positive_int", "integer", "count", "index":
+		return itemDataInteger
+	case "float", "real", "numb":
+		return itemDataFloat
+	}
+	return itemDataString
+}
+
+// trimUncertainty removes the standard uncertainty in parentheses from the
+// end of a number, if it has one. e.g., "1.234(5)" becomes "1.234".
+func trimUncertainty(s string) string {
+	if i := strings.IndexByte(s, '('); i > 0 && strings.HasSuffix(s, ")") {
+		return s[:i]
+	}
+	return s
+}
+
+// parseList parses the values of a CIF 2.0 list, up to and including the
+// end of the list. This assumes the start of the list has been consumed.
+func (p *parser) parseList(bname, name string) Value {
+	list := make(cifList, 0, 4)
+	for t := p.next(); t.typ != itemListEnd; t = p.next() {
+		list = append(list, p.parseValue(t, bname, name))
+	}
+	return list
+}
+
+// parseTable parses the entries of a CIF 2.0 table, up to and including the
+// end of the table. This assumes the start of the table has been consumed.
+func (p *parser) parseTable(bname, name string) Value {
+	table := make(cifTable, 4)
+	for t := p.next(); t.typ != itemTableEnd; t = p.next() {
+		if t.typ != itemTableKey {
+			p.errf("Expected a table key for data tag '%s' in block '%s', "+
+				"but got a '%s' instead.", name, bname, t.typ)
+		}
+		if _, ok := table[t.val]; ok {
+			p.errf("Table key '%s' is repeated for data tag '%s' in block "+
+				"'%s'.", t.val, name, bname)
+		}
+		table[t.val] = p.parseValue(p.next(), bname, name)
+	}
+	return table
+}
+
+func (p *parser) assertUniqueTag(b *Block, name string) {
 	_, iok := b.Items[name]
 	_, lok := b.Loops[name]
 	if iok || lok {
@@ -183,7 +319,18 @@ func (p *parser) assertUniqueTag(b Block, name string) {
 
 func isValueType(t itemType) bool {
 	return t == itemDataOmitted || t == itemDataMissing ||
-		t == itemDataInteger || t == itemDataFloat || t == itemDataString
+		t == itemDataInteger || t == itemDataFloat || t == itemDataString ||
+		isCompound(t)
+}
+
+// isScalar returns true if t is a value other than a CIF 2.0 list or table.
+func isScalar(t itemType) bool {
+	return isValueType(t) && !isCompound(t)
+}
+
+// isCompound returns true if t starts a CIF 2.0 list or table.
+func isCompound(t itemType) bool {
+	return t == itemListStart || t == itemTableStart
 }
 
 func isNull(t itemType) bool {
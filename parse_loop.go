@@ -13,6 +13,10 @@ type loopValues struct {
 	// value in the list. In particular, it is always string if a loop column
 	// has any combination of types (including missing and omitted).
 	typ itemType
+
+	// compound maps rows to the CIF 2.0 lists and tables in the column. It
+	// is nil if there are none.
+	compound map[int]Value
 }
 
 // convertLoopValues ensures that the Go type of each column of values in a
@@ -20,17 +24,26 @@ type loopValues struct {
 // when all values are integers. The []float64 type is *only* used when all
 // values are either integers or floats. The []string type is used in all other
 // circumstances.
-func (p *parser) convertLoopValues(b Block, vals []loopValues) *Loop {
+//
+// Regardless of the Go type chosen, the original text of every value is kept
+// so that it can be retrieved with Texts.
+func (p *parser) convertLoopValues(b *Block, vals []loopValues) *Loop {
 	lp := &Loop{
 		Columns: make(map[string]int, len(vals)),
 		Values:  make([]ValueLoop, len(vals)),
 	}
 	for i, val := range vals {
+		if typ := p.dictType(val.name); typ != itemDataNone &&
+			val.compound == nil {
+			val.typ = typ
+		}
 		switch val.typ {
 		case itemDataOmitted, itemDataMissing, itemDataString:
-			strs := make([]string, len(val.strs))
-			copy(strs, val.strs)
-			lp.Values[i] = AsValues(strs)
+			if val.compound != nil {
+				lp.Values[i] = compoundColumn(val)
+				continue
+			}
+			lp.Values[i] = cifStrings(copyStrs(val.strs))
 		case itemDataInteger:
 			nums := make([]int, len(val.strs))
 			for j, str := range val.strs {
@@ -39,13 +52,14 @@ func (p *parser) convertLoopValues(b Block, vals []loopValues) *Loop {
 					continue
 				}
 
-				n, err := strconv.Atoi(str)
+				n, err := strconv.Atoi(trimUncertainty(str))
 				if err != nil {
-					p.errf("Could not parse '%s' as integer: %s", str, err)
+					p.errf("Could not parse '%s' as integer for data tag "+
+						"'%s': %s", str, val.name, err)
 				}
 				nums[j] = n
 			}
-			lp.Values[i] = AsValues(nums)
+			lp.Values[i] = cifInts{ints: nums, texts: copyStrs(val.strs)}
 		case itemDataFloat:
 			nums := make([]float64, len(val.strs))
 			for j, str := range val.strs {
@@ -54,13 +68,14 @@ func (p *parser) convertLoopValues(b Block, vals []loopValues) *Loop {
 					continue
 				}
 
-				n, err := strconv.ParseFloat(str, 64)
+				n, err := strconv.ParseFloat(trimUncertainty(str), 64)
 				if err != nil {
-					p.errf("Could not parse '%s' as float: %s", str, err)
+					p.errf("Could not parse '%s' as float for data tag "+
+						"'%s': %s", str, val.name, err)
 				}
 				nums[j] = n
 			}
-			lp.Values[i] = AsValues(nums)
+			lp.Values[i] = cifFloats{floats: nums, texts: copyStrs(val.strs)}
 		default:
 			p.errf("Expected value for data tag '%s' in block '%s', but "+
 				"got a '%s' instead.", val.name, b.Name, val.typ)
@@ -69,11 +84,12 @@ func (p *parser) convertLoopValues(b Block, vals []loopValues) *Loop {
 	for i, val := range vals {
 		lp.Columns[val.name] = i
 		b.Loops[val.name] = lp
+		b.order = append(b.order, val.name)
 	}
 	return lp
 }
 
-func (p *parser) parseLoop(b Block) item {
+func (p *parser) parseLoop(b *Block) item {
 	loopLine := p.line // save start line for error messages
 
 	// Check that there's at least one data tag. Then slurp up any remaining
@@ -105,6 +121,14 @@ func (p *parser) parseLoop(b Block) item {
 	count := 0 // must end up being a multiple of len(loop.Columns)
 	for i := 0; isValueType(t.typ); t, i, count = p.next(), i+1, count+1 {
 		column := i % len(vals)
+		if isCompound(t.typ) {
+			v := p.parseValue(t, b.Name, vals[column].name)
+			if vals[column].compound == nil {
+				vals[column].compound = make(map[int]Value, 10)
+			}
+			vals[column].compound[len(vals[column].strs)] = v
+			t = item{typ: itemDataString, val: Text(v), line: t.line}
+		}
 		vals[column].strs = append(vals[column].strs, t.val)
 		if vals[column].typ == itemDataNone {
 			vals[column].typ = t.typ
@@ -127,3 +151,23 @@ func (p *parser) parseLoop(b Block) item {
 	p.convertLoopValues(b, vals)
 	return t
 }
+
+func copyStrs(strs []string) []string {
+	cpy := make([]string, len(strs))
+	copy(cpy, strs)
+	return cpy
+}
+
+// compoundColumn returns a column of values containing CIF 2.0 lists or
+// tables. Every other value in the column is a string.
+func compoundColumn(val loopValues) cifValues {
+	vals := make(cifValues, len(val.strs))
+	for j, str := range val.strs {
+		if v, ok := val.compound[j]; ok {
+			vals[j] = v
+		} else {
+			vals[j] = cifString(str)
+		}
+	}
+	return vals
+}
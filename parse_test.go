@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"flag"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -70,3 +71,209 @@ func TestParseDict(t *testing.T) {
 	frame = block.Frames["_entity_src_gen.pdbx_seq_type"]
 	pf("%v\n", frame.Items["item_type.code"])
 }
+
+func TestText(t *testing.T) {
+	data := `data_text
+_a 1.500
+_b +3
+_c 1e-2
+_d 'quoted value'
+loop_
+_x _y
+1.50 007
+.    ?
+2e3  -4
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := cif.Blocks["text"]
+	items := map[string]string{
+		"a": "1.500", "b": "+3", "c": "1e-2", "d": "quoted value",
+	}
+	for tag, want := range items {
+		if got := Text(block.Items[tag]); got != want {
+			t.Fatalf("Text of '%s' should be '%s' but is '%s'.", tag, want, got)
+		}
+	}
+	if f := block.Items["a"].Float(); f != 1.5 {
+		t.Fatalf("Float of 'a' should be 1.5 but is %v.", f)
+	}
+
+	lp := block.Loops["x"]
+	columns := map[string][]string{
+		"x": {"1.50", ".", "2e3"},
+		"y": {"007", "?", "-4"},
+	}
+	for tag, want := range columns {
+		got := Texts(lp.Get(tag))
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Texts of '%s' should be %v but are %v.", tag, want, got)
+		}
+	}
+	if ns := lp.Get("y").Ints(); !reflect.DeepEqual(ns, []int{7, 0, -4}) {
+		t.Fatalf("Ints of 'y' should be [7 0 -4] but are %v.", ns)
+	}
+
+	// Values constructed by hand still have a textual representation.
+	if s := Text(AsValue(12)); s != "12" {
+		t.Fatalf("Text of AsValue(12) should be '12' but is '%s'.", s)
+	}
+	texts := Texts(AsValues([]float64{0.25}))
+	if !reflect.DeepEqual(texts, []string{"0.25"}) {
+		t.Fatalf("Texts should be [0.25] but are %v.", texts)
+	}
+
+	// So do values implemented outside of this package.
+	if s := Text(testValue{1.5}); s != "1.5" {
+		t.Fatalf("Text of testValue{1.5} should be '1.5' but is '%s'.", s)
+	}
+
+	// Modifying the texts returned does not modify the column.
+	texts = Texts(lp.Get("x"))
+	texts[0] = "modified"
+	if got := Texts(lp.Get("x")); got[0] == "modified" {
+		t.Fatalf("Texts should return a copy of the texts of a column.")
+	}
+}
+
+// testValue is a Value implemented outside of the types in value.go.
+type testValue struct{ f float64 }
+
+func (tv testValue) String() string   { return "" }
+func (tv testValue) Int() int         { return int(tv.f) }
+func (tv testValue) Float() float64   { return tv.f }
+func (tv testValue) Raw() interface{} { return tv.f }
+
+func TestCIF2(t *testing.T) {
+	data := `#\#CIF_2.0
+data_cif2
+_list [1 2.5 'a b' [x ?] .]
+_table {'file':templ.cif "save":'''a
+b''' 'nested':{'k':[]}}
+_empty []
+_quote "it's"
+_triple """say "hi" """
+_unicode Å
+loop_
+_id _get
+1 [{'file':'a.cif'}]
+2 .
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cif.Version != "CIF_2.0" {
+		t.Fatalf("Version should be 'CIF_2.0' but is '%s'.", cif.Version)
+	}
+	block := cif.Blocks["cif2"]
+	texts := map[string]string{
+		"list":    "[1 2.5 'a b' [x ?] .]",
+		"table":   "{'file':templ.cif 'nested':{'k':[]} 'save':'''a\nb'''}",
+		"empty":   "[]",
+		"quote":   "it's",
+		"triple":  `say "hi" `,
+		"unicode": "Å",
+	}
+	for tag, want := range texts {
+		if got := Text(block.Items[tag]); got != want {
+			t.Fatalf("Text of '%s' should be %q but is %q.", tag, want, got)
+		}
+	}
+
+	list := block.Items["list"].Raw().([]Value)
+	if len(list) != 5 || list[0].Int() != 1 || list[1].Float() != 2.5 ||
+		list[2].String() != "a b" || list[4].String() != "." {
+		t.Fatalf("Wrong list: %v", list)
+	}
+	table := block.Items["table"].Raw().(map[string]Value)
+	if table["save"].String() != "a\nb" {
+		t.Fatalf("Wrong table: %v", table)
+	}
+
+	col := block.Loops["get"].Get("get").Raw().([]Value)
+	if col[1].String() != "." {
+		t.Fatalf("Wrong column: %v", col)
+	}
+	get := col[0].Raw().([]Value)[0].Raw().(map[string]Value)
+	if get["file"].String() != "a.cif" {
+		t.Fatalf("Wrong column: %v", col)
+	}
+
+	bad := []string{
+		"_a [1 2",
+		"_a [1 2}",
+		"_a {a:1}",
+		"_a {'a' 1}",
+		"_a ]",
+		"_a [1 2]x",
+		"_a 'it's'",
+	}
+	for _, s := range bad {
+		if _, err := Read(strings.NewReader(
+			"#\\#CIF_2.0\ndata_bad\n" + s + "\n")); err == nil {
+			t.Fatalf("Reading '%s' should fail.", s)
+		}
+	}
+}
+
+func TestReadWithDictionary(t *testing.T) {
+	dcif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(dcif)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `data_typed
+_atom_site_anisotrop.id '7'
+_other 1
+loop_
+_atom_site.id
+_atom_site.B_iso
+1 3
+2 1.5(2)
+3 ?
+`
+	cif, err := ReadWith(strings.NewReader(data), ReadOptions{Dictionary: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := cif.Blocks["typed"]
+	id := block.Items["atom_site_anisotrop.id"].Raw()
+	if n, ok := id.(int); !ok || n != 7 {
+		t.Fatalf("'atom_site_anisotrop.id' should be the int 7, but is %#v.",
+			id)
+	}
+	if _, ok := block.Items["other"].Raw().(int); !ok {
+		t.Fatalf("Undefined data tags should have inferred types.")
+	}
+	lp := block.Loops["atom_site.id"]
+	ids := lp.Get("atom_site.id").Raw()
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Fatalf("'atom_site.id' should be strings, but is %#v.", ids)
+	}
+	bs := lp.Get("atom_site.b_iso").Raw()
+	if !reflect.DeepEqual(bs, []float64{3, 1.5, 0}) {
+		t.Fatalf("'atom_site.b_iso' should be floats, but is %#v.", bs)
+	}
+	texts := Texts(lp.Get("atom_site.b_iso"))
+	if !reflect.DeepEqual(texts, []string{"3", "1.5(2)", "?"}) {
+		t.Fatalf("Wrong texts for 'atom_site.b_iso': %v", texts)
+	}
+
+	data = `data_bad
+loop_
+_atom_site_anisotrop.id
+1
+1A
+`
+	_, err = ReadWith(strings.NewReader(data), ReadOptions{Dictionary: d})
+	if err == nil {
+		t.Fatalf("Reading a non-integer for an integer data tag should fail.")
+	}
+}
@@ -0,0 +1,173 @@
+package cif
+
+import "strings"
+
+// Selection describes a subset of a CIF. It is used with Select.
+type Selection struct {
+	// Blocks contains the names of the data blocks to keep. If Blocks is
+	// empty, then every data block is kept.
+	Blocks []string
+
+	// Frames contains the names of the save frames to keep. If Frames is
+	// empty, then every save frame is kept.
+	Frames []string
+
+	// Tags contains patterns matching the data tags to keep. If Tags is empty,
+	// then every data tag is kept. A pattern matches a data tag when:
+	//
+	// The pattern is the data tag. e.g., "cell.length_a".
+	//
+	// The pattern is the category of the data tag, where the category is
+	// everything before the first '.'. e.g., "atom_site" matches
+	// "atom_site.id" but not "atom_site_anisotrop.id".
+	//
+	// The data tag has no '.' and starts with the pattern followed by an '_'.
+	// e.g., "cell" matches "cell_length_a". (This corresponds to categories
+	// in older CIF files that do not use '.' in their data tags.)
+	//
+	// The pattern ends with a '.' or '_' and is a prefix of the data tag.
+	// e.g., "atom_site_" matches both "atom_site_label" and
+	// "atom_site_aniso_label".
+	//
+	// Patterns are matched without regard to case or a leading underscore.
+	Tags []string
+}
+
+// Select returns a new CIF containing only the data blocks, save frames and
+// data items described by sel. When only some of the data tags in a table
+// match, the table in the new CIF contains only those columns. When Tags is
+// not empty, save frames left without any data items are dropped. Nil data
+// blocks and save frames are dropped too.
+//
+// The maps and tables of the new CIF are new, but the values themselves are
+// shared with cif. (So modifying a column of values in place modifies it in
+// both CIFs.)
+func (cif *CIF) Select(sel Selection) *CIF {
+	blocks := nameSet(sel.Blocks)
+	frames := nameSet(sel.Frames)
+	tags := make([]string, len(sel.Tags))
+	for i, tag := range sel.Tags {
+		tags[i] = strings.TrimPrefix(strings.ToLower(tag), "_")
+	}
+
+	selected := &CIF{
+		Version: cif.Version,
+		Blocks:  make(map[string]*DataBlock, len(cif.Blocks)),
+		order:   cif.order,
+	}
+	for name, b := range cif.Blocks {
+		if b == nil || len(blocks) > 0 && !blocks[name] {
+			continue
+		}
+		nb := &DataBlock{
+			Block:      selectBlock(&b.Block, tags),
+			Frames:     make(map[string]*SaveFrame, len(b.Frames)),
+			frameOrder: b.frameOrder,
+		}
+		for fname, frame := range b.Frames {
+			if frame == nil || len(frames) > 0 && !frames[fname] {
+				continue
+			}
+			nframe := &SaveFrame{Block: selectBlock(&frame.Block, tags)}
+			if len(tags) == 0 || len(nframe.Items) > 0 ||
+				len(nframe.Loops) > 0 {
+
+				nb.Frames[fname] = nframe
+			}
+		}
+		selected.Blocks[name] = nb
+	}
+	return selected
+}
+
+// selectBlock returns a copy of b with only the data tags matching one of the
+// patterns given. If there are no patterns, then every data tag is kept.
+func selectBlock(b *Block, patterns []string) Block {
+	nb := Block{
+		Name:  b.Name,
+		Items: make(map[string]Value, len(b.Items)),
+		Loops: make(map[string]*Loop, len(b.Loops)),
+		order: b.order,
+	}
+	for tag, val := range b.Items {
+		if matchAny(patterns, tag) {
+			nb.Items[tag] = val
+		}
+	}
+
+	selected := make(map[*Loop]*Loop, len(b.Loops))
+	for tag, lp := range b.Loops {
+		if !matchAny(patterns, tag) {
+			continue
+		}
+		if _, ok := selected[lp]; !ok {
+			selected[lp] = selectLoop(lp, patterns)
+		}
+		nb.Loops[tag] = selected[lp]
+	}
+	return nb
+}
+
+// selectLoop returns a copy of lp with only the columns matching one of the
+// patterns given. Columns keep their relative positions.
+func selectLoop(lp *Loop, patterns []string) *Loop {
+	order := make([]string, len(lp.Values))
+	for tag, i := range lp.Columns {
+		if i >= 0 && i < len(order) {
+			order[i] = tag
+		}
+	}
+	nlp := &Loop{
+		Columns: make(map[string]int, len(lp.Columns)),
+		Values:  make([]ValueLoop, 0, len(lp.Values)),
+	}
+	for i, tag := range order {
+		if len(tag) > 0 && matchAny(patterns, tag) {
+			nlp.Columns[tag] = len(nlp.Values)
+			nlp.Values = append(nlp.Values, lp.Values[i])
+		}
+	}
+	return nlp
+}
+
+// matchAny returns true if any of the patterns match the data tag given, or
+// if there are no patterns.
+func matchAny(patterns []string, tag string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if matchTag(p, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTag returns true if the pattern matches the data tag given. See the
+// documentation for Selection.Tags.
+func matchTag(pattern, tag string) bool {
+	switch {
+	case len(pattern) == 0:
+		return false
+	case pattern == tag:
+		return true
+	case strings.IndexByte(tag, '.') > -1:
+		if tagCategory(tag) == pattern {
+			return true
+		}
+	case strings.HasPrefix(tag, pattern+"_"):
+		return true
+	}
+	last := pattern[len(pattern)-1]
+	return (last == '.' || last == '_') && strings.HasPrefix(tag, pattern)
+}
+
+// nameSet returns the set of names given in lowercase.
+func nameSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
@@ -0,0 +1,118 @@
+package cif
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var cifSelect = `data_first
+_cell.length_a 10.0
+_cell.length_b 12.0
+_symmetry.space_group_name_h-m 'P 1'
+_entry.id FIRST
+loop_
+_atom_site.id
+_atom_site.type_symbol
+_atom_site_anisotrop.id
+1 C 1
+2 N 2
+save_frame
+_cell.volume 100
+save_
+save_other
+_entry.id OTHER
+save_
+data_second
+_cell_length_a 5.0
+_cellar_door open
+`
+
+func TestSelect(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifSelect))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel := cif.Select(Selection{
+		Tags: []string{"_cell", "Symmetry", "atom_site"},
+	})
+	if errs := sel.Validate(); errs != nil {
+		t.Fatalf("Selection is not valid:\n%s", errs)
+	}
+	first := sel.Blocks["first"]
+	for _, tag := range []string{"entry.id", "atom_site_anisotrop.id"} {
+		if _, ok := first.Items[tag]; ok {
+			t.Fatalf("Data tag '%s' should not have been selected.", tag)
+		}
+		if _, ok := first.Loops[tag]; ok {
+			t.Fatalf("Data tag '%s' should not have been selected.", tag)
+		}
+	}
+	lp := first.Loops["atom_site.type_symbol"]
+	if len(lp.Values) != 2 || lp.Columns["atom_site.type_symbol"] != 1 {
+		t.Fatalf("Unexpected columns in selected table: %v", lp.Columns)
+	}
+	if _, ok := first.Frames["other"]; ok {
+		t.Fatalf("Save frame 'other' has no selected data items, but it " +
+			"was kept.")
+	}
+	if _, ok := first.Frames["frame"].Items["cell.volume"]; !ok {
+		t.Fatalf("Save frame 'frame' should have 'cell.volume'.")
+	}
+	second := sel.Blocks["second"]
+	if _, ok := second.Items["cell_length_a"]; !ok {
+		t.Fatalf("Data tag 'cell_length_a' should have been selected.")
+	}
+	if _, ok := second.Items["cellar_door"]; ok {
+		t.Fatalf("Data tag 'cellar_door' should not have been selected.")
+	}
+
+	// The selection is written in the same order as the original.
+	buf := new(bytes.Buffer)
+	if err := sel.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	sel2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sel2.Blocks["first"].Block.Items, first.Items) {
+		t.Fatalf("Not equal:\n%#v\n------------\n%#v\n",
+			sel2.Blocks["first"].Items, first.Items)
+	}
+
+	sel = cif.Select(Selection{Blocks: []string{"FIRST"}, Frames: []string{}})
+	if len(sel.Blocks) != 1 || len(sel.Blocks["first"].Frames) != 2 {
+		t.Fatalf("Expected one data block with two save frames.")
+	}
+	cif.Blocks["first"].Frames["empty"] = &SaveFrame{Block: Block{
+		Name:  "empty",
+		Items: map[string]Value{},
+		Loops: map[string]*Loop{},
+	}}
+	sel = cif.Select(Selection{Frames: []string{"empty"}})
+	if _, ok := sel.Blocks["first"].Frames["empty"]; !ok {
+		t.Fatalf("Save frame 'empty' was selected without a tag filter, " +
+			"but it was dropped.")
+	}
+	sel = cif.Select(Selection{Frames: []string{"other"}})
+	if len(sel.Blocks["first"].Frames) != 1 {
+		t.Fatalf("Expected only save frame 'other'.")
+	}
+
+	// Nil data blocks and save frames are dropped instead of panicking.
+	cif.Blocks["nil"] = nil
+	cif.Blocks["first"].Frames["nil"] = nil
+	sel = cif.Select(Selection{})
+	if _, ok := sel.Blocks["nil"]; ok {
+		t.Fatalf("The nil data block should have been dropped.")
+	}
+	if _, ok := sel.Blocks["first"].Frames["nil"]; ok {
+		t.Fatalf("The nil save frame should have been dropped.")
+	}
+	if errs := sel.Validate(); errs != nil {
+		t.Fatalf("Selection is not valid:\n%s", errs)
+	}
+}
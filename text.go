@@ -0,0 +1,189 @@
+package cif
+
+import "strings"
+
+// This file implements the line folding and text prefix protocols for
+// semi-colon text fields. Both protocols are signaled by the first line of a
+// text field (immediately following the opening ';').
+//
+// A text field is folded when its first line consists of a single '\' and
+// optional whitespace. In a folded text field, the first line is ignored and
+// every line ending with a '\' (and optional whitespace) is joined with the
+// line following it. This permits arbitrarily long lines of text to be
+// written within a maximum line length.
+//
+// A text field is prefixed when its first line consists of a prefix (which
+// does not contain a '\') followed by a '\' and optional whitespace. Every
+// subsequent line must then start with the prefix. In a prefixed text field,
+// the first line is ignored and the prefix is removed from every other line.
+// This permits text with lines starting with a ';' (like an embedded CIF
+// file) to be written in a text field. If the prefix is followed by two '\'
+// characters instead of one, then the text field is also folded (after the
+// prefixes have been removed).
+
+// textPrefix is the prefix written when the text prefix protocol is used.
+const textPrefix = "> "
+
+// decodeTextField returns the contents of a text field (everything between
+// the opening and closing ';') with the line folding and text prefix
+// protocols undone. If the text field uses neither protocol, then it is
+// returned unchanged.
+func decodeTextField(s string) string {
+	first, rest := s, ""
+	nl := strings.IndexByte(s, '\n')
+	if nl > -1 {
+		first, rest = s[:nl], s[nl+1:]
+	}
+	marker := strings.TrimRight(first, " \t\r")
+	if !strings.HasSuffix(marker, "\\") {
+		return s
+	}
+	prefix, fold := marker[:len(marker)-1], true
+	if len(prefix) > 0 {
+		fold = strings.HasSuffix(prefix, "\\")
+		if fold {
+			prefix = prefix[:len(prefix)-1]
+		}
+		if len(prefix) == 0 || strings.ContainsRune(prefix, '\\') {
+			return s
+		}
+	}
+	if nl == -1 {
+		return ""
+	}
+
+	lines := strings.Split(rest, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, prefix) {
+			return s
+		}
+		lines[i] = line[len(prefix):]
+	}
+	if fold {
+		return unfoldLines(lines)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unfoldLines joins every line ending with a '\' (and optional whitespace)
+// with the line following it.
+func unfoldLines(lines []string) string {
+	unfolded := make([]string, 0, len(lines))
+	joined := ""
+	for _, line := range lines {
+		if isFoldLine(line) {
+			line = strings.TrimRight(line, " \t\r")
+			joined += line[:len(line)-1]
+			continue
+		}
+		unfolded = append(unfolded, joined+line)
+		joined = ""
+	}
+	if len(joined) > 0 {
+		unfolded = append(unfolded, joined)
+	}
+	return strings.Join(unfolded, "\n")
+}
+
+// encodeTextField returns s encoded as the contents of a text field, such
+// that no line of the text field (including the opening ';') is longer than
+// max. The line folding protocol is used when lines are too long, and the
+// text prefix protocol is used when a line would otherwise start with a ';'.
+// If neither is necessary, then s is returned unchanged. If max is not
+// greater than 0, then lines may be of any length.
+func encodeTextField(s string, max int) string {
+	lines := strings.Split(s, "\n")
+	fold := needsFolding(lines, "", max)
+	if !fold && !startsWithSemi(lines[1:]) {
+		return s
+	}
+	if fold {
+		folded := foldLines(lines, max, true)
+		if !startsWithSemi(folded) {
+			return strings.Join(append([]string{"\\"}, folded...), "\n")
+		}
+	}
+
+	marker := textPrefix + "\\"
+	if needsFolding(lines, textPrefix, max) {
+		lines = foldLines(lines, max-len(textPrefix), false)
+		marker += "\\"
+	}
+	prefixed := make([]string, 0, len(lines)+1)
+	prefixed = append(prefixed, marker)
+	for _, line := range lines {
+		prefixed = append(prefixed, textPrefix+line)
+	}
+	return strings.Join(prefixed, "\n")
+}
+
+// needsFolding returns true if the lines of a text field must be written
+// using the line folding protocol. This is true if any line (including the
+// leading ';' or prefix) would be longer than max, or if the first line would
+// be mistaken for the start of a folded or prefixed text field. If max is not
+// greater than 0, then lines may be of any length.
+func needsFolding(lines []string, prefix string, max int) bool {
+	if len(prefix) == 0 && isFoldLine(lines[0]) {
+		return true
+	}
+	if max <= 0 {
+		return false
+	}
+	for i, line := range lines {
+		width := len(prefix) + len(line)
+		if i == 0 && len(prefix) == 0 {
+			width++ // for the opening ';'
+		}
+		if width > max {
+			return true
+		}
+	}
+	return false
+}
+
+// foldLines returns the lines of a text field folded such that no line is
+// longer than max. (The line folding marker is not included.) If max is not
+// greater than 1, then lines are only folded when it's necessary to preserve
+// a trailing '\'. If avoidSemi is true, then lines are not folded
+// immediately before a ';' where possible.
+func foldLines(lines []string, max int, avoidSemi bool) []string {
+	folded := make([]string, 0, len(lines))
+	for _, line := range lines {
+		for max > 1 && (len(line) > max ||
+			(isFoldLine(line) && len(line)+1 > max)) {
+
+			// A line in a text field may not start with a ';', so try not to
+			// fold immediately before one.
+			n := max - 1
+			for avoidSemi && n > 1 && line[n] == ';' {
+				n--
+			}
+			folded = append(folded, line[:n]+"\\")
+			line = line[n:]
+		}
+		if isFoldLine(line) {
+			// A line that really does end with a '\' is folded into an
+			// empty line, so that its '\' is kept.
+			folded = append(folded, line+"\\", "")
+		} else {
+			folded = append(folded, line)
+		}
+	}
+	return folded
+}
+
+// startsWithSemi returns true if any of the lines given starts with a ';'.
+func startsWithSemi(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, ";") {
+			return true
+		}
+	}
+	return false
+}
+
+// isFoldLine returns true if line ends with a '\' followed by optional
+// whitespace.
+func isFoldLine(line string) bool {
+	return strings.HasSuffix(strings.TrimRight(line, " \t\r"), "\\")
+}
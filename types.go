@@ -9,6 +9,10 @@ type CIF struct {
 	// Blocks maps data block names to corresponding data blocks.
 	// Note that all data block names are stored in lowercase.
 	Blocks map[string]*DataBlock
+
+	// order contains the names of data blocks in the order in which they
+	// were read. It is used to write data blocks in the same order.
+	order []string
 }
 
 // Block represents the structure of any block-like section in a CIF file.
@@ -34,6 +38,11 @@ type Block struct {
 	// get the loop object, while the second time its used is to get the
 	// actual column of data.
 	Loops map[string]*Loop
+
+	// order contains the data tags of this block (both from Items and Loops)
+	// in the order in which they were read. It is used to write data items
+	// in the same order.
+	order []string
 }
 
 // DataBlock represents a data block in a CIF file.
@@ -44,6 +53,10 @@ type DataBlock struct {
 	// Frames maps save frame names to corresponding save frames.
 	// Note that all save frame names are stored in lowercase.
 	Frames map[string]*SaveFrame
+
+	// frameOrder contains the names of save frames in the order in which
+	// they were read. It is used to write save frames in the same order.
+	frameOrder []string
 }
 
 // SaveFrame represents a save frame in a CIF file.
@@ -67,7 +80,8 @@ type Loop struct {
 // corresponding to the data tag given in a particular block.
 //
 // The underlying type of ValueLoop is guaranteed to be []string, []int or
-// []float64. See the documentation for ValueLoop for more details.
+// []float64 (or []Value for some columns in CIF 2.0 files). See the
+// documentation for ValueLoop for more details.
 //
 // Note that all data tags are stored in lowercase.
 func (lp *Loop) Get(name string) ValueLoop {
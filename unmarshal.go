@@ -0,0 +1,208 @@
+package cif
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal stores the values of a block in v, which must be a pointer to a
+// slice of structs, such as the types written by Dictionary.WriteGo. Every
+// field of the struct with a struct tag of the form `cif:"atom_site.cartn_x"`
+// is set from the values of that data tag (ignoring case and a leading
+// underscore). Other fields are left alone.
+//
+// The slice is replaced with one struct for each row of the table that
+// contains the data tags, or with a single struct if the data tags are data
+// items that are not in a table. If none of the data tags are in the block,
+// then the slice is empty. It is an error for the data tags to be in
+// different tables, or for some to be in a table and some not.
+//
+// Fields must have type string, int or float64, or be a pointer to one of
+// them. A string field is set to the value's text (see Text), so that
+// numbers keep their original spelling. An int field may only be set from an
+// integer, while a float64 field may be set from an integer or a float.
+// Numbers read as strings (e.g., because the column has other strings) are
+// parsed. Any standard uncertainty in parentheses is dropped.
+//
+// Missing ("?") and omitted (".") values are null. A null value sets a
+// pointer field to nil and any other field to its zero value. So pointer
+// fields, which WriteGo writes with GoOptions.Pointers, are the only way to
+// tell a null value from an empty string or zero. Data tags that are not in
+// the block are null too. (Since Read does not record whether a value was
+// quoted, the quoted strings '?' and '.' are null as well.)
+func (b *Block) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice ||
+		rv.Elem().Type().Elem().Kind() != reflect.Struct {
+
+		return fmt.Errorf("Unmarshal needs a pointer to a slice of structs, "+
+			"but got '%T'.", v)
+	}
+	slice := rv.Elem()
+	typ := slice.Type().Elem()
+
+	fields := make([]unmarshalField, 0, typ.NumField())
+	var lp *Loop
+	loopTag, items := "", false
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("cif")
+		if len(tag) == 0 {
+			continue
+		}
+		if !canUnmarshal(field.Type) {
+			return fmt.Errorf("The field '%s' has type '%s', which cannot "+
+				"hold CIF values.", field.Name, field.Type)
+		}
+		f := unmarshalField{
+			index: i,
+			tag:   strings.TrimPrefix(strings.ToLower(tag), "_"),
+		}
+		if val, ok := b.Items[f.tag]; ok {
+			f.item, items = val, true
+		} else if other, ok := b.Loops[f.tag]; ok {
+			if lp == nil {
+				lp, loopTag = other, f.tag
+			} else if other != lp {
+				return fmt.Errorf("The data tags '%s' and '%s' are in "+
+					"different tables.", loopTag, f.tag)
+			}
+			f.column = other.Get(f.tag)
+			f.texts = columnTexts(f.column)
+		}
+		fields = append(fields, f)
+	}
+	if items && lp != nil {
+		return fmt.Errorf("Some of the data tags of '%s' are in a table and "+
+			"some are not.", typ)
+	}
+
+	rows := 0
+	if items {
+		rows = 1
+	} else if lp != nil {
+		for _, f := range fields {
+			if f.tag == loopTag {
+				rows = len(f.texts)
+			}
+		}
+	}
+	slice.Set(reflect.MakeSlice(slice.Type(), rows, rows))
+	for row := 0; row < rows; row++ {
+		st := slice.Index(row)
+		for _, f := range fields {
+			raw, text, err := f.value(row)
+			if err == nil {
+				err = setField(st.Field(f.index), raw, text)
+			}
+			if err != nil {
+				return fmt.Errorf("Could not unmarshal row %d of data tag "+
+					"'%s': %s", row+1, f.tag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// unmarshalField is a field of a struct and the values of its data tag,
+// which are either a data item or a column of a table (along with its texts,
+// which are only computed once). Both are nil when the data tag is not in the
+// block.
+type unmarshalField struct {
+	index  int
+	tag    string
+	item   Value
+	column ValueLoop
+	texts  []string
+}
+
+// value returns the underlying value and text of the field's data tag in the
+// row given. A data tag that is not in the block is missing ("?").
+func (f unmarshalField) value(row int) (interface{}, string, error) {
+	if f.item != nil {
+		return f.item.Raw(), Text(f.item), nil
+	}
+	if f.column == nil {
+		return "?", "?", nil
+	}
+	switch raw := f.column.Raw().(type) {
+	case []string:
+		return raw[row], raw[row], nil
+	case []int:
+		return raw[row], textAt(f.texts, row), nil
+	case []float64:
+		return raw[row], textAt(f.texts, row), nil
+	}
+	return nil, "", fmt.Errorf("A column of type '%T' is not supported.",
+		f.column.Raw())
+}
+
+// canUnmarshal returns true if a field of the type given can be set by
+// Unmarshal.
+func canUnmarshal(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Int, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setField sets a field to a value, given its underlying value and text.
+func setField(field reflect.Value, raw interface{}, text string) error {
+	null := isNullText(text)
+	if field.Kind() == reflect.Ptr {
+		if null {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), raw, text); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if null {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Int:
+		switch raw := raw.(type) {
+		case int:
+			field.SetInt(int64(raw))
+		case string:
+			n, err := strconv.Atoi(trimUncertainty(raw))
+			if err != nil {
+				return fmt.Errorf("The value '%s' is not an integer.", raw)
+			}
+			field.SetInt(int64(n))
+		default:
+			return fmt.Errorf("The value '%s' is not an integer.", text)
+		}
+	case reflect.Float64:
+		switch raw := raw.(type) {
+		case int:
+			field.SetFloat(float64(raw))
+		case float64:
+			field.SetFloat(raw)
+		case string:
+			f, err := strconv.ParseFloat(trimUncertainty(raw), 64)
+			if err != nil {
+				return fmt.Errorf("The value '%s' is not a number.", raw)
+			}
+			field.SetFloat(f)
+		default:
+			return fmt.Errorf("The value '%s' is not a number.", text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package cif
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes a single problem found while validating CIF
+// data.
+type ValidationError struct {
+	// Block, Frame and Tag identify where the problem is. Each is empty when
+	// not applicable.
+	Block, Frame, Tag string
+
+	// Row is the row (starting at 1) of the table containing the problem, or
+	// 0 if the problem is not in a particular row.
+	Row int
+
+	// Msg describes the problem.
+	Msg string
+}
+
+func (ve *ValidationError) Error() string {
+	loc := make([]string, 0, 4)
+	if len(ve.Block) > 0 {
+		loc = append(loc, sf("block '%s'", ve.Block))
+	}
+	if len(ve.Frame) > 0 {
+		loc = append(loc, sf("save frame '%s'", ve.Frame))
+	}
+	if len(ve.Tag) > 0 {
+		loc = append(loc, sf("tag '%s'", ve.Tag))
+	}
+	if ve.Row > 0 {
+		loc = append(loc, sf("row %d", ve.Row))
+	}
+	if len(loc) == 0 {
+		return sf("CIF validation error: %s", ve.Msg)
+	}
+	return sf("CIF validation error (%s): %s", strings.Join(loc, ", "), ve.Msg)
+}
+
+// ValidationErrors is a list of problems found while validating CIF data.
+// It is returned by Validate, and by Write when a CIF fails validation.
+type ValidationErrors []*ValidationError
+
+func (ves ValidationErrors) Error() string {
+	msgs := make([]string, len(ves))
+	for i, ve := range ves {
+		msgs[i] = ve.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type validator struct {
+	errs         ValidationErrors
+	block, frame string
+}
+
+func (v *validator) errf(tag string, row int, format string, a ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Block: v.block,
+		Frame: v.frame,
+		Tag:   tag,
+		Row:   row,
+		Msg:   sf(format, a...),
+	})
+}
+
+// Validate checks the structure of a CIF and returns every problem that
+// would prevent it from being written as a valid CIF file. In particular,
+// Validate checks that:
+//
+// Data block names, save frame names and data tags are non-empty, contain
+// only printable non-blank characters and match the keys used for them
+// (ignoring case). No two data tags in the same
+// block differ only in case.
+//
+// No data tag is both a data item and part of a table, and every data tag of
+// a table maps to that table in Loops.
+//
+// Every table has at least one row, all of its columns have the same length
+// and its Columns map the data tags to each position in Values exactly once.
+//
+// Every value has a type that can be written, strings contain only printable
+// characters and floats are not NaN or infinite.
+//
+// The CIF 1.1 specification also limits names to 75 characters, but Read
+// accepts longer names, so Validate does too. (Write can still refuse a name
+// that is longer than WriteOptions.MaxLineLength.)
+//
+// If there are no problems, then nil is returned. Otherwise, the error
+// returned has type ValidationErrors, which lists every problem in a
+// deterministic order.
+func (cif *CIF) Validate() error {
+	v := &validator{}
+	names := make([]string, 0, len(cif.Blocks))
+	for name := range cif.Blocks {
+		names = append(names, name)
+	}
+	for _, name := range ordered(cif.order, names, lessString) {
+		b := cif.Blocks[name]
+		v.block, v.frame = name, ""
+		if b == nil {
+			v.errf("", 0, "The data block is nil.")
+			continue
+		}
+		v.validateName("data block", name, b.Name)
+
+		frames := make([]string, 0, len(b.Frames))
+		for fname := range b.Frames {
+			frames = append(frames, fname)
+		}
+		v.validateBlock(&b.Block)
+		for _, fname := range ordered(b.frameOrder, frames, lessString) {
+			v.frame = fname
+			if b.Frames[fname] == nil {
+				v.errf("", 0, "The save frame is nil.")
+				continue
+			}
+			v.validateName("save frame", fname, b.Frames[fname].Name)
+			v.validateBlock(&b.Frames[fname].Block)
+		}
+	}
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// validateName checks that name is a valid name for a data block, save frame
+// or data tag, and that it matches the key used to store it.
+func (v *validator) validateName(what, key, name string) {
+	tag := ""
+	if what == "data tag" {
+		tag = key
+	}
+	switch {
+	case len(name) == 0:
+		v.errf(tag, 0, "The %s name is empty.", what)
+	case strings.IndexFunc(name, isBlankChar) > -1:
+		v.errf(tag, 0, "The %s name '%s' contains characters that are not "+
+			"printable non-blank characters.", what, name)
+	}
+	if strings.ToLower(name) != strings.ToLower(key) {
+		v.errf(tag, 0, "The %s name '%s' does not match its key '%s'.",
+			what, name, key)
+	}
+}
+
+func (v *validator) validateBlock(b *Block) {
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		if _, ok := b.Items[tag]; ok {
+			v.errf(tag, 0, "The data tag is both a data item and part of "+
+				"a table.")
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return lessTag(tags[i], tags[j]) })
+
+	lower := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		v.validateName("data tag", tag, tag)
+		if other, ok := lower[strings.ToLower(tag)]; ok {
+			v.errf(tag, 0, "The data tag differs from data tag '%s' only "+
+				"in case.", other)
+		}
+		lower[strings.ToLower(tag)] = tag
+	}
+
+	checked := make([]*Loop, 0, 10)
+	for _, tag := range tags {
+		if val, ok := b.Items[tag]; ok {
+			v.validateValue(tag, 0, val)
+			continue
+		}
+		lp := b.Loops[tag]
+		if lp == nil {
+			v.errf(tag, 0, "The table is nil.")
+			continue
+		}
+		if _, ok := lp.Columns[tag]; !ok {
+			v.errf(tag, 0, "The data tag maps to a table that does not "+
+				"have a column for it.")
+		}
+		if loopWritten(checked, lp) {
+			continue
+		}
+		checked = append(checked, lp)
+		v.validateLoop(b, lp)
+	}
+}
+
+func (v *validator) validateLoop(b *Block, lp *Loop) {
+	columns := make([]string, 0, len(lp.Columns))
+	for tag := range lp.Columns {
+		columns = append(columns, tag)
+	}
+	sort.Strings(columns)
+	if len(columns) == 0 {
+		v.errf("", 0, "A table has no data tags.")
+		return
+	}
+
+	order := make(map[int]string, len(lp.Columns))
+	for _, tag := range columns {
+		if other, ok := b.Loops[tag]; !ok || other != lp {
+			v.errf(tag, 0, "The data tag is a column of a table, but it "+
+				"does not map to that table in the block.")
+		}
+		i := lp.Columns[tag]
+		if i < 0 || i >= len(lp.Values) {
+			v.errf(tag, 0, "The column has position %d, but the table "+
+				"only has %d columns of values.", i, len(lp.Values))
+			continue
+		}
+		if other, ok := order[i]; ok {
+			v.errf(tag, 0, "The column has the same position (%d) as "+
+				"column '%s'.", i, other)
+			continue
+		}
+		order[i] = tag
+	}
+	if len(lp.Values) != len(columns) {
+		v.errf(columns[0], 0, "The table has %d data tags but %d columns "+
+			"of values.", len(columns), len(lp.Values))
+	}
+
+	length, first := -1, ""
+	for i, vals := range lp.Values {
+		tag, ok := order[i]
+		if !ok {
+			continue
+		}
+		n := v.validateColumn(tag, vals)
+		switch {
+		case n == 0:
+			v.errf(tag, 0, "The column has no values.")
+		case n < 0:
+		case length == -1:
+			length, first = n, tag
+		case n != length:
+			v.errf(tag, 0, "The column has %d values, but column '%s' has "+
+				"%d values.", n, first, length)
+		}
+	}
+}
+
+// validateColumn checks every value in a column and returns its length.
+func (v *validator) validateColumn(tag string, vals ValueLoop) int {
+	switch vals := vals.(type) {
+	case cifStrings:
+		for j, s := range vals {
+			v.validateString(tag, j+1, s)
+		}
+		return len(vals)
+	case cifInts:
+		return len(vals.ints)
+	case cifFloats:
+		for j, f := range vals.floats {
+			v.validateFloat(tag, j+1, f)
+		}
+		return len(vals.floats)
+	}
+	v.errf(tag, 0, "CIF does not support a column of type '%T'.", vals)
+	return -1
+}
+
+func (v *validator) validateValue(tag string, row int, val Value) {
+	switch val := val.(type) {
+	case cifString:
+		v.validateString(tag, row, string(val))
+	case cifInt:
+	case cifFloat:
+		v.validateFloat(tag, row, val.f)
+	default:
+		v.errf(tag, row, "CIF does not support value of type '%T'.", val)
+	}
+}
+
+func (v *validator) validateString(tag string, row int, s string) {
+	for _, r := range s {
+		if !isPrintChar(r) && !isNL(r) {
+			v.errf(tag, row, "The character %q is not a valid printable "+
+				"character in the CIF 1.1 specification.", r)
+			return
+		}
+	}
+}
+
+func (v *validator) validateFloat(tag string, row int, f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		v.errf(tag, row, "The float '%v' cannot be represented in the CIF "+
+			"1.1 specification.", f)
+	}
+}
@@ -0,0 +1,84 @@
+package cif
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cif, err := Read(strings.NewReader(cifSmall))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := cif.Validate(); errs != nil {
+		t.Fatalf("Expected no problems, but got:\n%s", errs)
+	}
+
+	// CIF 1.1 limits names to 75 characters, but Read accepts longer names,
+	// so they are valid too.
+	long := "long." + strings.Repeat("x", 100)
+	cif.Blocks["1ctf"].Items[long] = AsValue(1)
+	if errs := cif.Validate(); errs != nil {
+		t.Fatalf("Expected no problems with a long name, but got:\n%s", errs)
+	}
+	delete(cif.Blocks["1ctf"].Items, long)
+
+	block := cif.Blocks["1ctf"]
+	block.Items["bad tag"] = AsValue(1)
+	block.Items["a"] = AsValue(2)
+	block.Items["nan"] = AsValue(math.NaN())
+	block.Items["str"] = AsValue("tab\tand\x00null")
+	block.Loops["ragged"] = &Loop{
+		Columns: map[string]int{"ragged": 0, "short": 1},
+		Values: []ValueLoop{
+			AsValues([]string{"x", "y"}), AsValues([]string{"é"}),
+		},
+	}
+	block.Loops["short"] = block.Loops["ragged"]
+	block.Loops["columns"] = &Loop{
+		Columns: map[string]int{"columns": 1},
+		Values:  []ValueLoop{AsValues([]int{1})},
+	}
+	cif.Blocks["other"] = &DataBlock{Block: Block{Name: "different"}}
+
+	expected := []struct {
+		block, tag string
+		row        int
+		msg        string
+	}{
+		{"1ctf", "a", 0, "both a data item and part of a table"},
+		{"1ctf", "bad tag", 0, "not printable non-blank"},
+		{"1ctf", "columns", 0, "has position 1"},
+		{"1ctf", "nan", 0, "cannot be represented"},
+		{"1ctf", "short", 1, "not a valid printable character"},
+		{"1ctf", "short", 0, "has 1 values, but column 'ragged' has 2"},
+		{"1ctf", "str", 0, "not a valid printable character"},
+		{"other", "", 0, "does not match its key"},
+	}
+	errs, ok := cif.Validate().(ValidationErrors)
+	if !ok || len(errs) != len(expected) {
+		t.Fatalf("Expected %d problems, but got %d:\n%s",
+			len(expected), len(errs), errs)
+	}
+	for i, exp := range expected {
+		e := errs[i]
+		if e.Block != exp.block || e.Tag != exp.tag || e.Row != exp.row ||
+			!strings.Contains(e.Msg, exp.msg) {
+
+			t.Fatalf("Expected problem %d to be '%s' (block '%s', tag '%s', "+
+				"row %d), but got: %s", i, exp.msg, exp.block, exp.tag,
+				exp.row, e)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err = cif.Write(buf)
+	if _, ok := err.(ValidationErrors); !ok {
+		t.Fatalf("Expected ValidationErrors from Write, but got '%v'.", err)
+	}
+	if buf.Len() > 0 {
+		t.Fatalf("Expected no output from an invalid CIF, but got:\n%s", buf)
+	}
+}
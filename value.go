@@ -5,7 +5,8 @@ import (
 )
 
 // Value denotes any value in a data item. Its underlying type is guaranteed
-// to be string, int or float64.
+// to be string, int or float64. In CIF 2.0 files, it may also be a list
+// ([]Value) or a table (map[string]Value).
 // Note that this includes omitted (".") and unknown ("?") data. Both are
 // stored as strings.
 
@@ -31,26 +32,76 @@ type Value interface {
 	Raw() interface{}
 }
 
+// texter is implemented by the values of this package, which remember the
+// text they were read from.
+type texter interface {
+	Text() string
+}
+
+// Text returns a value exactly as it was spelled in the CIF file it was read
+// from (without any quotes or text field delimiters). e.g., a float written
+// as "1.500" has a Text of "1.500" even though its Float is 1.5. If the value
+// was not read from a file (i.e., it was created with AsValue, or it is not
+// a value from this package), then a textual representation of the value is
+// returned.
+func Text(v Value) string {
+	if t, ok := v.(texter); ok {
+		return t.Text()
+	}
+	switch raw := v.Raw().(type) {
+	case string:
+		return raw
+	case int:
+		return strconv.Itoa(raw)
+	case float64:
+		return strconv.FormatFloat(raw, 'f', -1, 64)
+	}
+	return sf("%v", v.Raw())
+}
+
 type cifString string
 
 func (cs cifString) String() string   { return string(cs) }
 func (cs cifString) Int() int         { return 0 }
 func (cs cifString) Float() float64   { return 0 }
 func (cs cifString) Raw() interface{} { return string(cs) }
+func (cs cifString) Text() string     { return string(cs) }
 
-type cifInt int
+// cifInt is an integer along with the text that it was parsed from. The text
+// is empty when the integer was not read from a CIF file.
+type cifInt struct {
+	n    int
+	text string
+}
 
 func (ci cifInt) String() string   { return "" }
-func (ci cifInt) Int() int         { return int(ci) }
-func (ci cifInt) Float() float64   { return float64(ci) }
-func (ci cifInt) Raw() interface{} { return int(ci) }
+func (ci cifInt) Int() int         { return ci.n }
+func (ci cifInt) Float() float64   { return float64(ci.n) }
+func (ci cifInt) Raw() interface{} { return ci.n }
+func (ci cifInt) Text() string {
+	if len(ci.text) > 0 {
+		return ci.text
+	}
+	return strconv.Itoa(ci.n)
+}
 
-type cifFloat float64
+// cifFloat is a float along with the text that it was parsed from. The text
+// is empty when the float was not read from a CIF file.
+type cifFloat struct {
+	f    float64
+	text string
+}
 
 func (cf cifFloat) String() string   { return "" }
-func (cf cifFloat) Int() int         { return int(cf) }
-func (cf cifFloat) Float() float64   { return float64(cf) }
-func (cf cifFloat) Raw() interface{} { return float64(cf) }
+func (cf cifFloat) Int() int         { return int(cf.f) }
+func (cf cifFloat) Float() float64   { return cf.f }
+func (cf cifFloat) Raw() interface{} { return cf.f }
+func (cf cifFloat) Text() string {
+	if len(cf.text) > 0 {
+		return cf.text
+	}
+	return strconv.FormatFloat(cf.f, 'f', -1, 64)
+}
 
 // AsValue returns a value that satisfies the Value interface if v
 // has type string, int or float. If v has any other type, this function will
@@ -63,9 +114,9 @@ func AsValue(v interface{}) Value {
 	case string:
 		return cifString(v)
 	case int:
-		return cifInt(v)
+		return cifInt{n: v}
 	case float64:
-		return cifFloat(v)
+		return cifFloat{f: v}
 	}
 	panic(sf("Type '%T' cannot be represented as a CIF value.", v))
 }
@@ -78,6 +129,10 @@ func AsValue(v interface{}) Value {
 // floats or a mixture of integers and floats where all integers are converted
 // to floats). If any other type of value is found in the column, then all
 // values are represented as strings.
+//
+// In CIF 2.0 files, a column containing any lists or tables has an
+// underlying type of []Value instead, where every other value in the column
+// is a string.
 type ValueLoop interface {
 	// Strings returns this value as a []string. If its underlying type is
 	// not []string, then it is converted to a string and returned.
@@ -92,51 +147,105 @@ type ValueLoop interface {
 	// floats. If its underlying type is []string, then nil is returned.
 	Floats() []float64
 
-	// Raw provides the underlying []string, []int or []float64 value. The
+	// Raw provides the underlying []string, []int or []float64 value (or
+	// []Value for a column of a CIF 2.0 file with lists or tables). The
 	// interface returned may be used in a type switch.
 	// (A ValueLoop itself is not amenable to type switching, since the types
 	// that satisfy it in this package are not exported.)
 	Raw() interface{}
 }
 
+// columnTexter is implemented by the columns of this package, which remember
+// the text each value was read from.
+type columnTexter interface {
+	Texts() []string
+}
+
+// Texts returns every value in a column exactly as it was spelled in the CIF
+// file it was read from. This is useful for numeric columns, where the
+// original spelling (e.g., "1.500", "+3" or "1e-2") and the positions of
+// omitted (".") and missing ("?") values are otherwise lost. If the column
+// was not read from a file (i.e., it was created with AsValues, or it is not
+// a column from this package), then the result of Strings is returned.
+//
+// The slice returned is a copy, so it may be modified freely.
+func Texts(vals ValueLoop) []string {
+	texts := columnTexts(vals)
+	cpy := make([]string, len(texts))
+	copy(cpy, texts)
+	return cpy
+}
+
+// columnTexts is like Texts, except the slice returned may be the one stored
+// in the column, so it must not be modified.
+func columnTexts(vals ValueLoop) []string {
+	if t, ok := vals.(columnTexter); ok {
+		return t.Texts()
+	}
+	return vals.Strings()
+}
+
 type cifStrings []string
 
 func (cs cifStrings) Strings() []string { return []string(cs) }
 func (cs cifStrings) Ints() []int       { return nil }
 func (cs cifStrings) Floats() []float64 { return nil }
 func (cs cifStrings) Raw() interface{}  { return []string(cs) }
+func (cs cifStrings) Texts() []string   { return []string(cs) }
 
-type cifInts []int
+// cifInts is a column of integers along with the text that each integer was
+// parsed from. texts is nil when the column was not read from a CIF file.
+type cifInts struct {
+	ints  []int
+	texts []string
+}
 
 func (ci cifInts) Strings() []string {
-	strs := make([]string, len(ci))
-	for i := range ci {
-		strs[i] = strconv.FormatInt(int64(ci[i]), 10)
+	strs := make([]string, len(ci.ints))
+	for i := range ci.ints {
+		strs[i] = strconv.FormatInt(int64(ci.ints[i]), 10)
 	}
 	return strs
 }
-func (ci cifInts) Ints() []int { return []int(ci) }
+func (ci cifInts) Ints() []int { return ci.ints }
 func (ci cifInts) Floats() []float64 {
-	floats := make([]float64, len(ci))
-	for i := range ci {
-		floats[i] = float64(ci[i])
+	floats := make([]float64, len(ci.ints))
+	for i := range ci.ints {
+		floats[i] = float64(ci.ints[i])
 	}
 	return floats
 }
-func (ci cifInts) Raw() interface{} { return []int(ci) }
+func (ci cifInts) Raw() interface{} { return ci.ints }
+func (ci cifInts) Texts() []string {
+	if ci.texts != nil {
+		return ci.texts
+	}
+	return ci.Strings()
+}
 
-type cifFloats []float64
+// cifFloats is a column of floats along with the text that each float was
+// parsed from. texts is nil when the column was not read from a CIF file.
+type cifFloats struct {
+	floats []float64
+	texts  []string
+}
 
 func (cf cifFloats) Strings() []string {
-	strs := make([]string, len(cf))
-	for i := range cf {
-		strs[i] = strconv.FormatFloat(cf[i], 'f', -1, 64)
+	strs := make([]string, len(cf.floats))
+	for i := range cf.floats {
+		strs[i] = strconv.FormatFloat(cf.floats[i], 'f', -1, 64)
 	}
 	return strs
 }
 func (cf cifFloats) Ints() []int       { return nil }
-func (cf cifFloats) Floats() []float64 { return []float64(cf) }
-func (cf cifFloats) Raw() interface{}  { return []float64(cf) }
+func (cf cifFloats) Floats() []float64 { return cf.floats }
+func (cf cifFloats) Raw() interface{}  { return cf.floats }
+func (cf cifFloats) Texts() []string {
+	if cf.texts != nil {
+		return cf.texts
+	}
+	return cf.Strings()
+}
 
 // AsValues returns a value that satisfies the ValueLoop interface if v
 // has type []string, []int or []float. If v has any other type, this function
@@ -149,9 +258,9 @@ func AsValues(v interface{}) ValueLoop {
 	case []string:
 		return cifStrings(v)
 	case []int:
-		return cifInts(v)
+		return cifInts{ints: v}
 	case []float64:
-		return cifFloats(v)
+		return cifFloats{floats: v}
 	}
 	panic(sf("Type '%T' cannot be represented as a CIF loop column.", v))
 }
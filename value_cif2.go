@@ -0,0 +1,91 @@
+package cif
+
+import (
+	"sort"
+	"strings"
+)
+
+// cifList is a CIF 2.0 list of values.
+type cifList []Value
+
+func (cl cifList) String() string   { return "" }
+func (cl cifList) Int() int         { return 0 }
+func (cl cifList) Float() float64   { return 0 }
+func (cl cifList) Raw() interface{} { return []Value(cl) }
+
+// Text returns the list as it would be written in a CIF 2.0 file.
+func (cl cifList) Text() string {
+	vals := make([]string, len(cl))
+	for i, v := range cl {
+		vals[i] = compoundText(v)
+	}
+	return "[" + strings.Join(vals, " ") + "]"
+}
+
+// cifTable is a CIF 2.0 table of values.
+type cifTable map[string]Value
+
+func (ct cifTable) String() string   { return "" }
+func (ct cifTable) Int() int         { return 0 }
+func (ct cifTable) Float() float64   { return 0 }
+func (ct cifTable) Raw() interface{} { return map[string]Value(ct) }
+
+// Text returns the table as it would be written in a CIF 2.0 file, with its
+// keys in sorted order.
+func (ct cifTable) Text() string {
+	keys := make([]string, 0, len(ct))
+	for key := range ct {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = quote2(key) + ":" + compoundText(ct[key])
+	}
+	return "{" + strings.Join(entries, " ") + "}"
+}
+
+// cifValues is a column of values in a table, where at least one value is a
+// CIF 2.0 list or table.
+type cifValues []Value
+
+func (cv cifValues) Strings() []string { return cv.Texts() }
+func (cv cifValues) Ints() []int       { return nil }
+func (cv cifValues) Floats() []float64 { return nil }
+func (cv cifValues) Raw() interface{}  { return []Value(cv) }
+func (cv cifValues) Texts() []string {
+	texts := make([]string, len(cv))
+	for i, v := range cv {
+		texts[i] = Text(v)
+	}
+	return texts
+}
+
+// compoundText returns the text of a value inside a list or table. Strings
+// are quoted when necessary.
+func compoundText(v Value) string {
+	if s, ok := v.(cifString); ok {
+		if isNullText(string(s)) || (len(s) > 0 &&
+			!strings.ContainsAny(string(s), " \t\n\r'\"[]{}#$_;") &&
+			!matchNumeric.MatchString(string(s))) {
+			return string(s)
+		}
+		return quote2(string(s))
+	}
+	return Text(v)
+}
+
+// quote2 quotes a string as it would be written in a CIF 2.0 file.
+func quote2(s string) string {
+	switch {
+	case strings.ContainsAny(s, "\n\r"):
+	case !strings.ContainsRune(s, '\''):
+		return "'" + s + "'"
+	case !strings.ContainsRune(s, '"'):
+		return `"` + s + `"`
+	}
+	if !strings.Contains(s, "'''") {
+		return "'''" + s + "'''"
+	}
+	return `"""` + s + `"""`
+}
@@ -1,104 +1,447 @@
 package cif
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-var (
-	matchNumeric1 = regexp.MustCompile(
-		"(\\+|-)?[0-9]+(\\.[0-9]*([eE](\\+|-)?[0-9]+)?)?")
-	matchNumeric2 = regexp.MustCompile(
-		"(\\+|-)?\\.[0-9]+([eE](\\+|-)?[0-9]+)?")
+// matchNumeric matches every string that the lexer would read as a number
+// if it were unquoted.
+var matchNumeric = regexp.MustCompile(
+	"^(\\+|-)?([0-9]+(\\.[0-9]*)?|\\.[0-9]*)([eE](\\+|-)?[0-9]*)?$")
+
+// WriteErrorKind classifies the errors that can occur while writing CIF data.
+type WriteErrorKind int
+
+const (
+	// WriteIO is an error returned by the underlying io.Writer.
+	WriteIO WriteErrorKind = iota
+
+	// WriteInvalidChar occurs when a string contains a character that cannot
+	// be written in a CIF file.
+	WriteInvalidChar
+
+	// WriteRaggedLoop occurs when the columns of a table have different
+	// lengths, or when a table has no rows.
+	WriteRaggedLoop
+
+	// WriteUnsupportedType occurs when a value or a column of values has a
+	// type that cannot be written in a CIF file.
+	WriteUnsupportedType
+
+	// WriteInvalidValue occurs when a number cannot be represented in a CIF
+	// file (e.g., NaN or infinity).
+	WriteInvalidValue
+
+	// WriteLineTooLong occurs when a data tag, name or number does not fit
+	// within the maximum line length.
+	WriteLineTooLong
+
+	// WriteInvalidStructure occurs when data is written in the wrong place,
+	// e.g., a data item outside of a data block or a duplicate data tag.
+	WriteInvalidStructure
 )
 
-type writeError string
+func (kind WriteErrorKind) String() string {
+	switch kind {
+	case WriteIO:
+		return "I/O error"
+	case WriteInvalidChar:
+		return "invalid character"
+	case WriteRaggedLoop:
+		return "ragged loop"
+	case WriteUnsupportedType:
+		return "unsupported value type"
+	case WriteInvalidValue:
+		return "invalid value"
+	case WriteLineTooLong:
+		return "line too long"
+	case WriteInvalidStructure:
+		return "invalid structure"
+	}
+	return sf("unknown write error (%d)", int(kind))
+}
+
+// WriteError is the type of every error returned while writing CIF data
+// with an Encoder, or with Write or WriteWith after the CIF has been
+// validated.
+type WriteError struct {
+	Kind WriteErrorKind
+
+	// Block, Frame and Tag identify the data block, save frame and data tag
+	// being written when the error occurred. Each is empty when not
+	// applicable.
+	Block, Frame, Tag string
+
+	// Err is the underlying error returned by the io.Writer when Kind is
+	// WriteIO. Otherwise, it is nil.
+	Err error
+
+	msg string
+}
+
+func (we *WriteError) Error() string {
+	loc := make([]string, 0, 3)
+	if len(we.Block) > 0 {
+		loc = append(loc, sf("block '%s'", we.Block))
+	}
+	if len(we.Frame) > 0 {
+		loc = append(loc, sf("save frame '%s'", we.Frame))
+	}
+	if len(we.Tag) > 0 {
+		loc = append(loc, sf("tag '%s'", we.Tag))
+	}
+	if len(loc) == 0 {
+		return sf("CIF write error (%s): %s", we.Kind, we.msg)
+	}
+	return sf("CIF write error (%s, %s): %s",
+		we.Kind, strings.Join(loc, ", "), we.msg)
+}
 
-func (we writeError) Error() string {
-	return string(we)
+// Unwrap returns the underlying I/O error, if any.
+func (we *WriteError) Unwrap() error {
+	return we.Err
 }
 
 type writer struct {
 	*CIF
-	w io.Writer
+	w    io.Writer
+	opts WriteOptions
+
+	// The location currently being written, for error messages.
+	block, frame, tag string
+
+	// cif2 is true when the output declares itself as CIF 2.0, where strings
+	// are quoted by stricter rules.
+	cif2 bool
+}
+
+// WriteOptions controls the output of WriteWith. The zero value of
+// WriteOptions corresponds to the output of Write.
+type WriteOptions struct {
+	// Precision maps data tags (in lowercase and without the leading
+	// underscore) to the number of digits written after the decimal point
+	// for every floating point value of that tag. Floating point values of
+	// tags not in Precision are written with their original text when it is
+	// available, and otherwise with the shortest representation that reads
+	// back as exactly the same float. A negative precision (like the -1 of
+	// strconv.FormatFloat) always writes the shortest representation, even
+	// when the original text is available.
+	Precision map[string]int
+
+	// Canonical, when true, normalizes all whitespace in the output: data
+	// tags and values are separated by a single space, values in a table
+	// row are separated by a single space and no line has trailing
+	// whitespace. Strings are quoted with the default QuotePolicy,
+	// regardless of Quoting. Combined with the stable ordering of Write,
+	// this makes the output suitable for content hashing and golden-file
+	// tests.
+	Canonical bool
+
+	// Pretty, when true, aligns values for easier reading. The values of
+	// consecutive data items in the same category start in the same column,
+	// and each column of a table is aligned (strings on the left and
+	// numbers on their decimal points). Table rows wider than 80 characters
+	// are broken across multiple lines. Pretty is ignored when Canonical is
+	// true.
+	Pretty bool
+
+	// MaxLineLength, when greater than 0, is the maximum length of any line
+	// written. (The CIF 1.1 specification limits lines to 2048 characters,
+	// and some older software requires lines of at most 80 characters.)
+	// Table rows and data items are broken across multiple lines as
+	// necessary. Strings that are too long to fit on a single line are
+	// written as semi-colon text fields, and text fields with lines that are
+	// too long are written using the CIF line folding protocol. (Read
+	// unfolds such text fields.) If a data tag, data block name or number
+	// is too long to fit on a single line, then Write returns an error.
+	MaxLineLength int
+
+	// Quoting determines how strings are quoted.
+	Quoting QuotePolicy
+}
+
+// QuotePolicy determines how strings are quoted. The zero value of
+// QuotePolicy quotes strings only when necessary (i.e., when the string
+// would otherwise be read as something else), and prefers double quotes to
+// single quotes.
+//
+// Regardless of policy, strings with new lines are always written as
+// semi-colon text fields, and so are strings that cannot be quoted with
+// either quotation mark. The strings "." and "?" are never quoted, since
+// they represent omitted and missing values.
+type QuotePolicy struct {
+	// Always, when true, quotes every string, even when it is not
+	// necessary.
+	Always bool
+
+	// PreferSingle, when true, quotes strings with single quotes instead of
+	// double quotes whenever either would work.
+	PreferSingle bool
+
+	// TextLength, when greater than 0, writes every string longer than
+	// TextLength as a semi-colon text field.
+	TextLength int
 }
 
 // Write writes an existing CIF to the writer given.
 // It is appropriate to read a CIF with Read, modify it in place, and then
 // call Write.
-// Note that Write does not currently impose an ordering on the data items
-// written (except for the columns in a table).
+// The output of Write is deterministic. Data blocks, save frames and data
+// items are written in the order in which they were read. Anything added
+// after reading (or anything in a CIF that was not read at all) is written
+// afterwards, sorted by name. (Data tags are sorted by category first, where
+// the category of a tag is everything before the first '.'.) Save frames are
+// written after the data items of the data block that contains them.
+//
+// Numeric values are written exactly as they were spelled in the file they
+// were read from. Numeric values created with AsValue or AsValues are written
+// with the shortest representation that reads back as exactly the same number.
+//
+// If the CIF's Version is "CIF_2.0", then strings are quoted by the rules of
+// CIF 2.0, so that the output reads back as the same CIF. (e.g., "a[1]" is
+// quoted, since '[' starts a list in CIF 2.0.)
+//
+// Before anything is written, the CIF is checked with Validate. If there are
+// any problems, then nothing is written and the problems are returned as
+// ValidationErrors. Otherwise, any error returned has type *WriteError.
+//
+// The CIF is written to memory first and only copied to w once all of it has
+// been written successfully, so that an error (like WriteLineTooLong) never
+// leaves partial output behind. Only an error from w itself can do that.
 func (cif *CIF) Write(w io.Writer) error {
-	return writer{cif, w}.write()
+	return cif.WriteWith(w, WriteOptions{})
 }
 
-func (w writer) errf(format string, v ...interface{}) {
-	err := fmt.Sprintf(format, v...)
-	panic(writeError(fmt.Sprintf("CIF write: %s", err)))
+// WriteWith is like Write, except the output is controlled by the options
+// given.
+func (cif *CIF) WriteWith(w io.Writer, opts WriteOptions) error {
+	if err := cif.Validate(); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := (&writer{CIF: cif, w: buf, opts: opts}).write(); err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		return &WriteError{Kind: WriteIO, Err: err, msg: err.Error()}
+	}
+	return nil
+}
+
+func (w *writer) errf(kind WriteErrorKind, format string, v ...interface{}) {
+	w.fail(kind, nil, format, v...)
+}
+
+// fail stops writing with an error of the kind given. err is the underlying
+// error, if any.
+func (w *writer) fail(kind WriteErrorKind, err error,
+	format string, v ...interface{}) {
+
+	panic(&WriteError{
+		Kind:  kind,
+		Block: w.block,
+		Frame: w.frame,
+		Tag:   w.tag,
+		Err:   err,
+		msg:   fmt.Sprintf(format, v...),
+	})
 }
 
-func (w writer) pf(format string, v ...interface{}) {
+func (w *writer) pf(format string, v ...interface{}) {
 	if _, err := fmt.Fprintf(w.w, format, v...); err != nil {
-		w.errf("%s", err)
+		w.fail(WriteIO, err, "%s", err)
 	}
 }
 
-func (w writer) write() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if e, ok := r.(cifError); ok {
-				err = e
-				return
-			}
+// recover converts a panic caused by errf into an error. Any other panic is
+// propagated.
+func (w *writer) recover(err *error) {
+	if r := recover(); r != nil {
+		if e, ok := r.(*WriteError); ok {
+			*err = e
+			return
 		}
-	}()
+		panic(r)
+	}
+}
+
+func (w *writer) write() (err error) {
+	defer w.recover(&err)
 	if len(w.Version) > 0 {
 		w.pf("#\\#%s\n", w.Version)
+		w.cif2 = w.Version == "CIF_2.0"
 	}
-	for _, b := range w.Blocks {
-		w.writeDataBlock(b)
+	names := make([]string, 0, len(w.Blocks))
+	for name := range w.Blocks {
+		names = append(names, name)
+	}
+	for _, name := range ordered(w.order, names, lessString) {
+		w.writeDataBlock(w.Blocks[name])
 	}
 	return nil
 }
 
-func (w writer) writeDataBlock(b *DataBlock) {
+func (w *writer) writeDataBlock(b *DataBlock) {
+	w.block, w.frame, w.tag = b.Name, "", ""
+	w.checkLength("data_" + b.Name)
 	w.pf("data_%s\n", b.Name)
-	for _, frame := range b.Frames {
-		w.pf("save_%s\n", frame.Name)
-		w.writeBlock(frame.Block)
+	w.writeBlock(&b.Block)
+
+	names := make([]string, 0, len(b.Frames))
+	for name := range b.Frames {
+		names = append(names, name)
+	}
+	for _, name := range ordered(b.frameOrder, names, lessString) {
+		w.frame = b.Frames[name].Name
+		w.checkLength("save_" + b.Frames[name].Name)
+		w.pf("save_%s\n", b.Frames[name].Name)
+		w.writeBlock(&b.Frames[name].Block)
 		w.pf("save_\n")
 	}
-	w.writeBlock(b.Block)
+	w.frame = ""
 }
 
-func (w writer) writeBlock(b Block) {
-	for tag, val := range b.Items {
-		w.pf("_%s    %s\n", tag, w.valToStr(val))
+func (w *writer) writeBlock(b *Block) {
+	tags := make([]string, 0, len(b.Items)+len(b.Loops))
+	for tag := range b.Items {
+		tags = append(tags, tag)
+	}
+	for tag := range b.Loops {
+		tags = append(tags, tag)
+	}
+
+	tags = ordered(b.order, tags, lessTag)
+	var widths map[string]int
+	if w.pretty() {
+		widths = itemWidths(b, tags)
 	}
 
 	written := make([]*Loop, 0, 10)
-	for _, lp := range b.Loops {
+	for _, tag := range tags {
+		w.tag = tag
+		if val, ok := b.Items[tag]; ok {
+			w.checkLength("_" + tag)
+			name := "_" + tag
+			if w.pretty() {
+				name = padRight(name, widths[tag])
+			}
+			w.writeValues([]string{name, w.valToStr(tag, val)},
+				w.itemSep(), w.width())
+			continue
+		}
+		lp := b.Loops[tag]
+		if lp == nil {
+			w.errf(WriteInvalidStructure, "The table is nil.")
+		}
 		if loopWritten(written, lp) {
 			continue
 		}
 		w.writeLoop(lp)
 		written = append(written, lp)
 	}
+	w.tag = ""
 }
 
-func (w writer) writeLoop(lp *Loop) {
-	w.pf("loop_\n")
+// pretty returns true if values should be aligned.
+func (w *writer) pretty() bool {
+	return w.opts.Pretty && !w.opts.Canonical
+}
+
+// width returns the width at which lines of values are broken, or 0 if lines
+// should never be broken.
+func (w *writer) width() int {
+	max := w.opts.MaxLineLength
+	if w.pretty() && (max <= 0 || max > prettyWidth) {
+		return prettyWidth
+	}
+	if max > 0 {
+		return max
+	}
+	return 0
+}
+
+// checkLength fails if s is too long to fit on a single line.
+func (w *writer) checkLength(s string) {
+	if max := w.opts.MaxLineLength; max > 0 && len(s) > max {
+		w.errf(WriteLineTooLong,
+			"'%s' is longer than the maximum line length (%d).", s, max)
+	}
+}
+
+// itemSep returns the whitespace written between a data tag and its value.
+func (w *writer) itemSep() string {
+	if w.opts.Canonical || w.pretty() {
+		return " "
+	}
+	return "    "
+}
+
+// loopSep returns the whitespace written between values in a table row.
+func (w *writer) loopSep() string {
+	if w.opts.Canonical {
+		return " "
+	}
+	return "  "
+}
 
+// writeValues writes the formatted values given on a single line, separated
+// by sep. The exception is semi-colon text fields, which always start and end
+// their own lines. If width is greater than 0, then lines are broken between
+// values so that no line is longer than width (unless a single value is
+// longer than width). Trailing whitespace is never written.
+func (w *writer) writeValues(vals []string, sep string, width int) {
+	line := ""
+	flush := func() {
+		if len(line) > 0 {
+			w.pf("%s\n", strings.TrimRight(line, " "))
+			line = ""
+		}
+	}
+	for _, val := range vals {
+		switch {
+		case isTextField(val):
+			flush()
+			w.pf("%s\n", val[1:])
+		case len(line) == 0:
+			line = val
+		case width > 0 &&
+			len(line)+len(sep)+len(strings.TrimRight(val, " ")) > width:
+
+			flush()
+			line = val
+		default:
+			line += sep + val
+		}
+	}
+	flush()
+}
+
+func (w *writer) writeLoop(lp *Loop) {
 	order := make(map[int]string, len(lp.Columns))
 	for column, i := range lp.Columns {
+		if i < 0 || i >= len(lp.Values) {
+			w.errf(WriteRaggedLoop, "Column '%s' has position %d, but the "+
+				"table only has %d columns.", column, i, len(lp.Values))
+		}
 		order[i] = column
 	}
-	for i := 0; i < len(lp.Values); i++ {
-		w.pf("_%s\n", order[i])
+	if len(order) != len(lp.Values) || len(order) != len(lp.Columns) {
+		w.errf(WriteRaggedLoop, "The table has %d data tags but %d "+
+			"columns of values.", len(lp.Columns), len(lp.Values))
 	}
+
+	// Format every value before writing anything, so that a bad value
+	// doesn't leave a partially written table behind.
 	strs := make([][]string, len(lp.Values))
 	for i := range lp.Values {
+		w.tag = order[i]
 		switch vals := lp.Values[i].(type) {
 		case cifStrings:
 			strs[i] = make([]string, len(vals))
@@ -106,103 +449,281 @@ func (w writer) writeLoop(lp *Loop) {
 				strs[i][j] = w.formatStr(val)
 			}
 		case cifInts:
-			strs[i] = make([]string, len(vals))
-			for j, val := range vals {
-				strs[i][j] = fmt.Sprintf("%d", val)
+			strs[i] = make([]string, len(vals.ints))
+			for j, val := range vals.ints {
+				strs[i][j] = w.formatInt(val, textAt(vals.texts, j))
 			}
 		case cifFloats:
-			strs[i] = make([]string, len(vals))
-			for j, val := range vals {
-				strs[i][j] = fmt.Sprintf("%f", val)
+			strs[i] = make([]string, len(vals.floats))
+			for j, val := range vals.floats {
+				strs[i][j] = w.formatFloat(
+					order[i], val, textAt(vals.texts, j))
 			}
+		default:
+			w.errf(WriteUnsupportedType,
+				"CIF does not support a column of type '%T'.", vals)
+		}
+		if len(strs[i]) == 0 {
+			w.errf(WriteRaggedLoop, "The column has no values.")
+		}
+		if len(strs[i]) != len(strs[0]) {
+			w.errf(WriteRaggedLoop, "The column has %d values, but column "+
+				"'%s' has %d values.", len(strs[i]), order[0], len(strs[0]))
 		}
 	}
-	for row := 0; row < len(strs[0]); row++ {
-		before := ""
+	w.tag = order[0]
+
+	w.pf("loop_\n")
+	for i := 0; i < len(lp.Values); i++ {
+		w.checkLength("_" + order[i])
+		w.pf("_%s\n", order[i])
+	}
+	if w.pretty() {
+		alignColumns(lp, strs)
+	}
+	row := make([]string, len(strs))
+	for i := 0; i < len(strs[0]); i++ {
 		for column := 0; column < len(strs); column++ {
-			w.pf("%s%s", before, strs[column][row])
-			before = "  "
+			row[column] = strs[column][i]
 		}
-		w.pf("\n")
+		w.writeValues(row, w.loopSep(), w.width())
 	}
 }
 
-func (w writer) valToStr(v Value) string {
+func (w *writer) valToStr(tag string, v Value) string {
 	switch v := v.(type) {
 	case cifString:
 		return w.formatStr(string(v))
 	case cifInt:
-		return fmt.Sprintf("%d", v)
+		return w.formatInt(v.n, v.text)
 	case cifFloat:
-		return fmt.Sprintf("%f", v)
+		return w.formatFloat(tag, v.f, v.text)
 	default:
-		w.errf("CIF does not support value of type '%T'.", v)
+		w.errf(WriteUnsupportedType,
+			"CIF does not support value of type '%T'.", v)
 	}
 	panic("unreachable")
 }
 
-// formatStr examines the contents of the given string to determine how to
-// write it. It decides between unquoted, single-quoted, double-quoted or
-// a semi-colon text field. The first three are only used for strings without
-// new lines. Semi-colon text fields are used otherwise. Quoted values are used
-// when a string contains quotation marks. If a string contains both ' and ",
-// then a semi-colon text field is used.
-func (w writer) formatStr(s string) string {
-	// We know this is a string, but if it looks numeric, quote it.
-	if matchNumeric1.MatchString(s) || matchNumeric2.MatchString(s) {
-		return "\"" + s + "\""
+// formatInt writes n using its original text if that text still corresponds
+// to n. (It may not if n was changed after it was read.) The text may have a
+// standard uncertainty, which is kept.
+func (w *writer) formatInt(n int, text string) string {
+	if isNullText(text) && n == 0 {
+		return text
 	}
+	if m, err := strconv.Atoi(trimUncertainty(text)); err == nil && m == n {
+		w.checkLength(text)
+		return text
+	}
+	s := strconv.Itoa(n)
+	w.checkLength(s)
+	return s
+}
+
+// formatFloat writes f for the data tag given. If the tag has a precision in
+// the writer options, then f is written with that many digits after the
+// decimal point. Otherwise, f is written using its original text (including
+// any standard uncertainty) if that text still corresponds to f, or with the
+// shortest representation that reads back as exactly f.
+func (w *writer) formatFloat(tag string, f float64, text string) string {
+	if isNullText(text) && f == 0 {
+		return text
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		w.errf(WriteInvalidValue, "The float '%v' cannot be represented "+
+			"in the CIF 1.1 specification.", f)
+	}
+	var s string
+	g, err := strconv.ParseFloat(trimUncertainty(text), 64)
+	if prec, ok := w.opts.Precision[tag]; ok && prec < 0 {
+		s = shortestFloat(f)
+	} else if ok {
+		s = strconv.FormatFloat(f, 'f', prec, 64)
+		if prec == 0 {
+			// Make sure it's still read as a float.
+			s += "."
+		}
+	} else if err == nil && g == f {
+		s = text
+	} else {
+		s = shortestFloat(f)
+	}
+	w.checkLength(s)
+	return s
+}
+
+// shortestFloat returns the shortest string that reads back as exactly f.
+// The string always contains either a decimal point or an exponent, so that
+// it is never mistaken for an integer.
+func shortestFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// isNullText returns true if text is the omitted (".") or missing ("?")
+// value.
+func isNullText(text string) bool {
+	return text == "." || text == "?"
+}
+
+// textAt returns the i'th text in texts, or the empty string if there are no
+// texts.
+func textAt(texts []string, i int) string {
+	if i < len(texts) {
+		return texts[i]
+	}
+	return ""
+}
 
+// formatStr examines the contents of the given string to determine how to
+// write it, according to the quoting policy in the writer options. It
+// decides between unquoted, single-quoted, double-quoted or a semi-colon text
+// field. The first three are only used for strings without new lines.
+// Semi-colon text fields are used otherwise, or when a string cannot be
+// quoted with either quotation mark. (If any line in a text field starts with
+// a ';', then the text prefix protocol is used.)
+func (w *writer) formatStr(s string) string {
 	// N.B. We used some functions from the lexer for convenience.
-	which := "unquoted"
-	seenDouble, seenSingle := false, false
-LOOP:
 	for _, r := range s {
-		switch {
-		case isNL(r):
-			which = "text"
-			break LOOP
-		case r == '"':
-			seenDouble = true
-			// If we've already seen single, then just go to text field.
-			if seenSingle {
-				which = "text"
-				break LOOP
-			}
-			which = "single"
-		case r == '\'':
-			seenSingle = true
-			// If we've already seen double, then just go to text field.
-			if seenDouble {
-				which = "text"
-				break LOOP
-			}
-			which = "double"
-		case !isOrdinaryChar(r):
-			if seenDouble && seenSingle {
-				which = "text"
-				break LOOP
-			} else if seenDouble {
-				which = "single"
-			} else { // if both are false or if only seenSingle is true
-				which = "double"
-			}
-		case !isPrintChar(r):
-			w.errf("The character '%c' is not a valid printable character "+
-				"in the CIF 1.1 specification.", r)
+		if !isPrintChar(r) && !isNL(r) {
+			w.errf(WriteInvalidChar,
+				"The character '%c' is not a valid printable character "+
+					"in the CIF 1.1 specification.", r)
 		}
 	}
-	switch which {
-	case "unquoted":
+
+	policy := w.opts.Quoting
+	if w.opts.Canonical {
+		policy = QuotePolicy{}
+	}
+	switch {
+	case strings.ContainsAny(s, "\n\r"):
+		return w.textField(s)
+	case policy.TextLength > 0 && len(s) > policy.TextLength:
+		return w.textField(s)
+	case isNullText(s):
 		return s
-	case "single":
-		return "'" + s + "'"
-	case "double":
-		return "\"" + s + "\""
-	case "text":
-		return "\n;" + s + "\n;"
-	}
-	panic(sf("unreachable: (unknown string format type '%s')", which))
+	case !policy.Always && canUnquote(s) &&
+		!(w.cif2 && strings.ContainsAny(s, "[]{}")):
+		return w.fitStr(s, s)
+	}
+
+	first, second := "\"", "'"
+	if policy.PreferSingle {
+		first, second = second, first
+	}
+	if canQuote(s, first[0], w.cif2) {
+		return w.fitStr(s, first+s+first)
+	}
+	if canQuote(s, second[0], w.cif2) {
+		return w.fitStr(s, second+s+second)
+	}
+	return w.textField(s)
+}
+
+// canUnquote returns true if s can be written without quotes and still be
+// read as the same string.
+func canUnquote(s string) bool {
+	if len(s) == 0 || !isOrdinaryChar(rune(s[0])) || s[0] == dataMissing {
+		return false
+	}
+	if strings.IndexFunc(s, isBlankChar) > -1 || matchNumeric.MatchString(s) {
+		return false
+	}
+	lower := strings.ToLower(s)
+	for _, word := range []string{"data_", "save_", "loop_", "stop_",
+		"global_"} {
+		if strings.HasPrefix(lower, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// canQuote returns true if s can be written with the quotation mark given.
+// This is true unless the quotation mark appears in s followed by whitespace
+// (which would end the quoted string early). In CIF 2.0 (when cif2 is true),
+// a quoted string ends at the first quotation mark, so it may not appear in s
+// at all.
+func canQuote(s string, quote byte, cif2 bool) bool {
+	if cif2 {
+		return strings.IndexByte(s, quote) == -1
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == quote && i+1 < len(s) && isWhiteSpace(rune(s[i+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+// fitStr returns the formatted string given, unless it is too long to fit on
+// a single line. In that case, the string is written as a text field instead.
+func (w *writer) fitStr(s, formatted string) string {
+	if max := w.opts.MaxLineLength; max > 0 && len(formatted) > max {
+		return w.textField(s)
+	}
+	return formatted
+}
+
+// textField returns s formatted as a semi-colon text field. The line folding
+// and text prefix protocols are used as necessary.
+func (w *writer) textField(s string) string {
+	return "\n;" + encodeTextField(s, w.opts.MaxLineLength) + "\n;"
+}
+
+// isTextField returns true if the formatted value given is a semi-colon text
+// field.
+func isTextField(formatted string) bool {
+	return strings.HasPrefix(formatted, "\n;")
+}
+
+// ordered returns the names given in a deterministic order. Names in order
+// come first (skipping any that are not in names), followed by all other
+// names sorted with less.
+func ordered(order, names []string, less func(a, b string) bool) []string {
+	all := make(map[string]bool, len(names))
+	for _, name := range names {
+		all[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for _, name := range order {
+		if all[name] {
+			sorted = append(sorted, name)
+			delete(all, name)
+		}
+	}
+	rest := make([]string, 0, len(all))
+	for name := range all {
+		rest = append(rest, name)
+	}
+	sort.Slice(rest, func(i, j int) bool { return less(rest[i], rest[j]) })
+	return append(sorted, rest...)
+}
+
+func lessString(a, b string) bool {
+	return a < b
+}
+
+// lessTag orders data tags by category first and then by the entire tag.
+func lessTag(a, b string) bool {
+	if ca, cb := tagCategory(a), tagCategory(b); ca != cb {
+		return ca < cb
+	}
+	return a < b
+}
+
+// tagCategory returns the category of the data tag given, which is everything
+// before the first '.'. If there is no '.', then the entire tag is returned.
+func tagCategory(tag string) string {
+	if i := strings.IndexByte(tag, '.'); i > -1 {
+		return tag[:i]
+	}
+	return tag
 }
 
 // loopWritten returns true if the loop given has already been written for
@@ -0,0 +1,111 @@
+package cif
+
+import "strings"
+
+// prettyWidth is the width at which lines are broken when pretty printing.
+const prettyWidth = 80
+
+// itemWidths returns the width that the data tags of items in the given block
+// should be padded to. Consecutive items (in the order given by tags) that
+// belong to the same category are padded to the same width, so that their
+// values start in the same column.
+func itemWidths(b *Block, tags []string) map[string]int {
+	widths := make(map[string]int, len(b.Items))
+	run := make([]string, 0, 10)
+	finish := func() {
+		width := 0
+		for _, tag := range run {
+			if len(tag)+1 > width {
+				width = len(tag) + 1
+			}
+		}
+		for _, tag := range run {
+			widths[tag] = width
+		}
+		run = run[:0]
+	}
+	for _, tag := range tags {
+		if _, ok := b.Items[tag]; !ok {
+			finish()
+			continue
+		}
+		if len(run) > 0 && tagCategory(run[0]) != tagCategory(tag) {
+			finish()
+		}
+		run = append(run, tag)
+	}
+	finish()
+	return widths
+}
+
+// alignColumns pads the formatted values of each column in the loop given so
+// that every value in a column has the same width. Strings are aligned on the
+// left while numbers are aligned on their decimal points. Semi-colon text
+// fields are left alone, since they are always written on their own lines.
+func alignColumns(lp *Loop, strs [][]string) {
+	for i := range strs {
+		switch lp.Values[i].(type) {
+		case cifInts, cifFloats:
+			alignNumbers(strs[i])
+		default:
+			alignStrings(strs[i])
+		}
+	}
+}
+
+func alignStrings(column []string) {
+	width := 0
+	for _, s := range column {
+		if !isTextField(s) && len(s) > width {
+			width = len(s)
+		}
+	}
+	for j, s := range column {
+		if !isTextField(s) {
+			column[j] = padRight(s, width)
+		}
+	}
+}
+
+// alignNumbers pads each number so that the integer parts of every number are
+// right aligned and the fractional parts (which include exponents) are left
+// aligned.
+func alignNumbers(column []string) {
+	intWidth, fracWidth := 0, 0
+	for _, s := range column {
+		whole, frac := splitNumber(s)
+		if len(whole) > intWidth {
+			intWidth = len(whole)
+		}
+		if len(frac) > fracWidth {
+			fracWidth = len(frac)
+		}
+	}
+	for j, s := range column {
+		whole, frac := splitNumber(s)
+		column[j] = padLeft(whole, intWidth) + padRight(frac, fracWidth)
+	}
+}
+
+// splitNumber splits a formatted number into its integer part and the rest
+// (its decimal point, fractional digits and exponent).
+func splitNumber(s string) (whole, frac string) {
+	if i := strings.IndexAny(s, ".eE"); i > -1 && !isNullText(s) {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+func padRight(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+func padLeft(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat(" ", width-len(s)) + s
+}
@@ -3,6 +3,8 @@ package cif
 import (
 	"bytes"
 	"compress/gzip"
+	"io"
+	"math"
 	"os"
 	"reflect"
 	"strings"
@@ -61,3 +63,680 @@ func TestPDBWriter(t *testing.T) {
 		t.Fatalf("Not equal:\n%s\n------------\n%s\n", cif, cif2)
 	}
 }
+
+func TestWriteFloats(t *testing.T) {
+	floats := []float64{
+		0, 1e-9, 12.5, 0.1, 1.0 / 3.0, -2.75, 12, 1e21, 6.02214076e23,
+		math.MaxFloat64, math.SmallestNonzeroFloat64, -math.Pi,
+	}
+	cif := &CIF{
+		Blocks: map[string]*DataBlock{
+			"floats": {
+				Block: Block{
+					Name: "floats",
+					Items: map[string]Value{
+						"single": AsValue(1e-9),
+						"round":  AsValue(12.0),
+					},
+					Loops: map[string]*Loop{},
+				},
+				Frames: map[string]*SaveFrame{},
+			},
+		},
+	}
+	lp := &Loop{
+		Columns: map[string]int{"x": 0},
+		Values:  []ValueLoop{AsValues(floats)},
+	}
+	cif.Blocks["floats"].Loops["x"] = lp
+
+	buf := new(bytes.Buffer)
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	cif2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := cif2.Blocks["floats"]
+	got := block.Loops["x"].Get("x").Floats()
+	if len(got) != len(floats) {
+		t.Fatalf("Expected %d floats but got %d.", len(floats), len(got))
+	}
+	for i := range floats {
+		if math.Float64bits(got[i]) != math.Float64bits(floats[i]) {
+			t.Fatalf("Float %d did not round-trip: wrote %v, read %v.",
+				i, floats[i], got[i])
+		}
+	}
+	for tag, want := range map[string]float64{"single": 1e-9, "round": 12} {
+		v := block.Items[tag]
+		if _, ok := v.Raw().(float64); !ok || v.Float() != want {
+			t.Fatalf("Item '%s' should be the float %v but is %#v.",
+				tag, want, v.Raw())
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	data := `data_text
+_a 1.500
+_b +3
+loop_
+_x _y
+1.50 1.23456
+. ?
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	cif2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cif, cif2) {
+		t.Fatalf("Not equal:\n%#v\n------------\n%#v\n", cif, cif2)
+	}
+
+	buf.Reset()
+	opts := WriteOptions{Precision: map[string]int{"y": 2, "a": 0}}
+	if err := cif.WriteWith(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	cif3, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := cif3.Blocks["text"]
+	texts := Texts(block.Loops["y"].Get("y"))
+	if !reflect.DeepEqual(texts, []string{"1.23", "?"}) {
+		t.Fatalf("Column 'y' should be [1.23 ?] but is %v.", texts)
+	}
+	if s := Text(block.Items["a"]); s != "2." {
+		t.Fatalf("Item 'a' should be '2.' but is '%s'.", s)
+	}
+
+	// A negative precision writes the shortest representation.
+	buf.Reset()
+	opts = WriteOptions{Precision: map[string]int{"x": -1, "a": -1}}
+	if err := cif.WriteWith(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	cif4, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block = cif4.Blocks["text"]
+	texts = Texts(block.Loops["x"].Get("x"))
+	if !reflect.DeepEqual(texts, []string{"1.5", "."}) {
+		t.Fatalf("Column 'x' should be [1.5 .] but is %v.", texts)
+	}
+	if s := Text(block.Items["a"]); s != "1.5" {
+		t.Fatalf("Item 'a' should be '1.5' but is '%s'.", s)
+	}
+}
+
+func TestWriteQuoting(t *testing.T) {
+	tests := []struct {
+		policy QuotePolicy
+		s      string
+		want   string
+	}{
+		{QuotePolicy{}, "A1", "A1"},
+		{QuotePolicy{}, "1ABC", "1ABC"},
+		{QuotePolicy{}, "1.5e3", `"1.5e3"`},
+		{QuotePolicy{}, "-.5", `"-.5"`},
+		{QuotePolicy{}, "", `""`},
+		{QuotePolicy{}, "a b", `"a b"`},
+		{QuotePolicy{}, "_a", `"_a"`},
+		{QuotePolicy{}, "#a", `"#a"`},
+		{QuotePolicy{}, "?a", `"?a"`},
+		{QuotePolicy{}, "Loop_x", `"Loop_x"`},
+		{QuotePolicy{}, "a\" b", `'a" b'`},
+		{QuotePolicy{}, "a\" b' c", "\n;a\" b' c\n;"},
+		{QuotePolicy{}, ".", "."},
+		{QuotePolicy{Always: true}, "A1", `"A1"`},
+		{QuotePolicy{Always: true}, "?", "?"},
+		{QuotePolicy{PreferSingle: true}, "a b", "'a b'"},
+		{QuotePolicy{PreferSingle: true}, "a' b", `"a' b"`},
+		{QuotePolicy{TextLength: 3}, "abcd", "\n;abcd\n;"},
+		{QuotePolicy{TextLength: 3}, "abc", "abc"},
+	}
+	for _, test := range tests {
+		w := &writer{opts: WriteOptions{Quoting: test.policy}}
+		got := w.formatStr(test.s)
+		if got != test.want {
+			t.Errorf("Policy %+v: '%s' should be written as '%s' but is "+
+				"'%s'.", test.policy, test.s, test.want, got)
+			continue
+		}
+		if isNullText(test.s) {
+			continue
+		}
+		cif, err := Read(strings.NewReader("data_q\n_t " + got + "\n"))
+		if err != nil {
+			t.Errorf("Could not read '%s': %s", got, err)
+			continue
+		}
+		if s := Text(cif.Blocks["q"].Items["t"]); s != test.s {
+			t.Errorf("'%s' should be read as '%s' but is '%s'.",
+				got, test.s, s)
+		}
+	}
+
+	w := &writer{opts: WriteOptions{
+		Canonical: true,
+		Quoting:   QuotePolicy{Always: true, PreferSingle: true},
+	}}
+	if got := w.formatStr("a b"); got != `"a b"` {
+		t.Errorf("Canonical output should ignore the quoting policy, but "+
+			"'a b' is written as '%s'.", got)
+	}
+}
+
+func TestWriteCanonical(t *testing.T) {
+	data := `#\#CIF_1.1
+data_b
+_zeta.id   1
+_alpha.id 'a b'
+loop_
+_atom.id _atom.name
+1 'C 1'
+2
+;N
+O
+;
+data_a
+_x 2.50
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Items added after reading are written after items that were read.
+	cif.Blocks["a"].Items["cell.b"] = AsValue(2)
+	cif.Blocks["a"].Items["cell.a"] = AsValue(1)
+
+	expected := `#\#CIF_1.1
+data_b
+_zeta.id 1
+_alpha.id "a b"
+loop_
+_atom.id
+_atom.name
+1 "C 1"
+2
+;N
+O
+;
+data_a
+_x 2.50
+_cell.a 1
+_cell.b 2
+`
+	for i := 0; i < 5; i++ {
+		buf := new(bytes.Buffer)
+		err := cif.WriteWith(buf, WriteOptions{Canonical: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != expected {
+			t.Fatalf("Expected:\n%s\n------------\nGot:\n%s\n", expected, got)
+		}
+	}
+}
+
+func TestWritePretty(t *testing.T) {
+	data := `data_pretty
+_cell.length_a 10.5
+_cell.z 4
+_entry.id ABC
+loop_
+_atom.name _atom.x _atom.occupancy
+CA 1.5 1
+N -12.25 0.5
+OXT 100 ?
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `data_pretty
+_cell.length_a 10.5
+_cell.z        4
+_entry.id ABC
+loop_
+_atom.name
+_atom.x
+_atom.occupancy
+CA     1.5   1
+N    -12.25  0.5
+OXT  100     ?
+`
+	buf := new(bytes.Buffer)
+	if err := cif.WriteWith(buf, WriteOptions{Pretty: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expected {
+		t.Fatalf("Expected:\n%s\n------------\nGot:\n%s\n", expected, got)
+	}
+
+	cif2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cif, cif2) {
+		t.Fatalf("Not equal:\n%#v\n------------\n%#v\n", cif, cif2)
+	}
+}
+
+func TestWritePrettyWide(t *testing.T) {
+	tags := make(map[string]int)
+	vals := make([]ValueLoop, 12)
+	for i := range vals {
+		tags[sf("column%02d", i)] = i
+		vals[i] = AsValues([]string{strings.Repeat("x", 10)})
+	}
+	cif := &CIF{
+		Blocks: map[string]*DataBlock{
+			"wide": {
+				Block: Block{
+					Name:  "wide",
+					Items: map[string]Value{},
+					Loops: map[string]*Loop{},
+				},
+			},
+		},
+	}
+	lp := &Loop{Columns: tags, Values: vals}
+	for tag := range tags {
+		cif.Blocks["wide"].Loops[tag] = lp
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cif.WriteWith(buf, WriteOptions{Pretty: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > 80 {
+			t.Fatalf("Line is longer than 80 characters: '%s'", line)
+		}
+	}
+	cif2, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cif2.Blocks["wide"].Loops["column11"].Get("column11").Strings()
+	if len(got) != 1 || got[0] != strings.Repeat("x", 10) {
+		t.Fatalf("Expected a single row in the table, but got %v.", got)
+	}
+}
+
+func TestWriteMaxLineLength(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 30)
+	values := []string{
+		long,
+		"a short line\n" + long + "\nand another",
+		"a line ending with a backslash\\\nnext",
+		"\\\nlooks folded",
+		strings.Repeat(";", 100),
+		"x" + strings.Repeat(";", 100),
+	}
+	block := &DataBlock{
+		Block: Block{
+			Name:  "long",
+			Items: map[string]Value{},
+			Loops: map[string]*Loop{},
+		},
+	}
+	for i, v := range values {
+		block.Items[sf("item%d", i)] = AsValue(v)
+	}
+	tags := map[string]int{}
+	vals := make([]ValueLoop, 30)
+	for i := range vals {
+		tags[sf("column%02d", i)] = i
+		vals[i] = AsValues([]float64{1.25, -3.5e-7})
+	}
+	lp := &Loop{Columns: tags, Values: vals}
+	for tag := range tags {
+		block.Loops[tag] = lp
+	}
+	cif := &CIF{Blocks: map[string]*DataBlock{"long": block}}
+
+	for _, max := range []int{80, 40} {
+		buf := new(bytes.Buffer)
+		opts := WriteOptions{MaxLineLength: max}
+		if err := cif.WriteWith(buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if len(line) > max {
+				t.Fatalf("Line is longer than %d characters: '%s'", max, line)
+			}
+		}
+		cif2, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block2 := cif2.Blocks["long"]
+		for i, v := range values {
+			got := block2.Items[sf("item%d", i)].String()
+			if got != v {
+				t.Fatalf("Expected '%s' but got '%s'.", v, got)
+			}
+		}
+		got := block2.Loops["column29"].Get("column29").Floats()
+		if !reflect.DeepEqual(got, []float64{1.25, -3.5e-7}) {
+			t.Fatalf("Expected [1.25 -3.5e-07] but got %v.", got)
+		}
+	}
+}
+
+func TestReadFolded(t *testing.T) {
+	data := `data_folded
+_a
+;\
+This is a long line \
+that has been folded.
+Backslash\\
+
+;
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "This is a long line that has been folded.\nBackslash\\"
+	if got := cif.Blocks["folded"].Items["a"].String(); got != expected {
+		t.Fatalf("Expected '%s' but got '%s'.", expected, got)
+	}
+}
+
+func TestTextPrefix(t *testing.T) {
+	values := []string{
+		"data_embedded\n_a\n;\ntext\n;\n_b 1",
+		";\n;\n;",
+		"first\\\n;second",
+		"> \\\n> looks prefixed",
+	}
+	block := &DataBlock{
+		Block: Block{
+			Name:  "prefix",
+			Items: map[string]Value{},
+			Loops: map[string]*Loop{},
+		},
+	}
+	for i, v := range values {
+		block.Items[sf("item%d", i)] = AsValue(v)
+	}
+	cif := &CIF{Blocks: map[string]*DataBlock{"prefix": block}}
+
+	for _, max := range []int{0, 20} {
+		buf := new(bytes.Buffer)
+		opts := WriteOptions{MaxLineLength: max}
+		if err := cif.WriteWith(buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		cif2, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range values {
+			got := cif2.Blocks["prefix"].Items[sf("item%d", i)].String()
+			if got != v {
+				t.Fatalf("Expected '%s' but got '%s'.", v, got)
+			}
+		}
+	}
+}
+
+func TestReadPrefixed(t *testing.T) {
+	data := `data_prefixed
+_a
+;CIF>\
+CIF>data_inner
+CIF>;
+CIF>text
+CIF>;
+;
+_b
+;P:\\
+P:folded \
+P:line
+;
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := cif.Blocks["prefixed"]
+	expected := "data_inner\n;\ntext\n;"
+	if got := block.Items["a"].String(); got != expected {
+		t.Fatalf("Expected '%s' but got '%s'.", expected, got)
+	}
+	expected = "folded line"
+	if got := block.Items["b"].String(); got != expected {
+		t.Fatalf("Expected '%s' but got '%s'.", expected, got)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriteErrors(t *testing.T) {
+	newCIF := func() (*CIF, *Block) {
+		block := &DataBlock{
+			Block: Block{
+				Name:  "errors",
+				Items: map[string]Value{"a": AsValue(1)},
+				Loops: map[string]*Loop{},
+			},
+		}
+		return &CIF{Blocks: map[string]*DataBlock{"errors": block}},
+			&block.Block
+	}
+	tests := []struct {
+		modify func(b *Block)
+		w      io.Writer
+		opts   WriteOptions
+		kind   WriteErrorKind
+		tag    string
+		valid  bool // whether the CIF passes Validate
+	}{
+		{
+			func(b *Block) {}, failWriter{}, WriteOptions{},
+			WriteIO, "", true,
+		},
+		{
+			func(b *Block) { b.Items["bad"] = AsValue("café") },
+			nil, WriteOptions{}, WriteInvalidChar, "bad", false,
+		},
+		{
+			func(b *Block) {
+				lp := &Loop{
+					Columns: map[string]int{"x": 0, "y": 1},
+					Values: []ValueLoop{
+						AsValues([]int{1, 2}), AsValues([]int{1}),
+					},
+				}
+				b.Loops["x"], b.Loops["y"] = lp, lp
+			},
+			nil, WriteOptions{}, WriteRaggedLoop, "y", false,
+		},
+		{
+			func(b *Block) { b.Items["nan"] = AsValue(math.NaN()) },
+			nil, WriteOptions{}, WriteInvalidValue, "nan", false,
+		},
+		{
+			func(b *Block) { b.Items["none"] = nil },
+			nil, WriteOptions{}, WriteUnsupportedType, "none", false,
+		},
+		{
+			func(b *Block) { b.Items[strings.Repeat("t", 80)] = AsValue(1) },
+			nil, WriteOptions{MaxLineLength: 80}, WriteLineTooLong,
+			strings.Repeat("t", 80), true,
+		},
+	}
+	for _, test := range tests {
+		cif, block := newCIF()
+		test.modify(block)
+		w := test.w
+		if w == nil {
+			w = new(bytes.Buffer)
+		}
+
+		// Skip Validate, so that the writer finds the problem itself.
+		err := (&writer{CIF: cif, w: w, opts: test.opts}).write()
+		werr, ok := err.(*WriteError)
+		if !ok {
+			t.Fatalf("Expected a *WriteError but got '%v'.", err)
+		}
+		if werr.Kind != test.kind || werr.Tag != test.tag ||
+			werr.Block != "errors" {
+
+			t.Fatalf("Expected a '%s' error for tag '%s' in block 'errors', "+
+				"but got: %s", test.kind, test.tag, werr)
+		}
+		if test.kind == WriteIO && werr.Err != io.ErrClosedPipe {
+			t.Fatalf("Expected the underlying I/O error, but got '%v'.",
+				werr.Err)
+		}
+	}
+
+	// WriteWith reports the same problems, either from Validate or from the
+	// writer, and never leaves partial output behind.
+	for _, test := range tests {
+		cif, block := newCIF()
+		test.modify(block)
+		buf := new(bytes.Buffer)
+		w := test.w
+		if w == nil {
+			w = buf
+		}
+		err := cif.WriteWith(w, test.opts)
+		if !test.valid {
+			if _, ok := err.(ValidationErrors); !ok {
+				t.Fatalf("Expected ValidationErrors for tag '%s', but got "+
+					"'%v'.", test.tag, err)
+			}
+		} else if werr, ok := err.(*WriteError); !ok || werr.Kind != test.kind {
+			t.Fatalf("Expected a '%s' error for tag '%s', but got '%v'.",
+				test.kind, test.tag, err)
+		}
+		if buf.Len() > 0 {
+			t.Fatalf("Expected no output after an error, but got:\n%s", buf)
+		}
+	}
+
+}
+
+func TestWriteUncertainty(t *testing.T) {
+	dcif, err := Read(strings.NewReader(cifDDL2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDDL2(dcif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ReadOptions{Dictionary: d}
+
+	data := `data_su
+_atom_site_anisotrop.id 7(1)
+loop_
+_atom_site.id
+_atom_site.B_iso
+1 3
+2 1.5(2)
+3 -0.25(10)
+`
+	cif, err := ReadWith(strings.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+	for _, s := range []string{"7(1)", "1.5(2)", "-0.25(10)"} {
+		if !strings.Contains(written, s) {
+			t.Fatalf("The standard uncertainty of %s was not written:\n%s",
+				s, written)
+		}
+	}
+	read, err := ReadWith(buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, cif) {
+		t.Fatalf("The CIF changed after writing and reading it:\n%s", written)
+	}
+
+	// A value changed after reading is written without its old text.
+	cif.Blocks["su"].Loops["atom_site.id"].Get("atom_site.b_iso").
+		Floats()[1] = 1.75
+	buf.Reset()
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); strings.Contains(s, "1.5(2)") ||
+		!strings.Contains(s, "1.75") {
+
+		t.Fatalf("The changed value should be written as 1.75:\n%s", s)
+	}
+}
+
+func TestWriteCIF2(t *testing.T) {
+	data := `#\#CIF_2.0
+data_x
+_a 'a[1]'
+_b "x{y}"
+_c "it's"
+_d 'say "hi"'
+_e
+;
+a' "b
+;
+_f plain
+`
+	cif, err := Read(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+	if !strings.HasPrefix(written, "#\\#CIF_2.0\n") {
+		t.Fatalf("The CIF 2.0 header should be written:\n%s", written)
+	}
+	read, err := Read(buf)
+	if err != nil {
+		t.Fatalf("Could not read the CIF written:\n%s\n%s", written, err)
+	}
+	if !reflect.DeepEqual(read, cif) {
+		t.Fatalf("The CIF changed after writing and reading it:\n%s", written)
+	}
+
+	// The same strings are written for CIF 1.1 with fewer quotes.
+	cif.Version = "CIF_1.1"
+	buf.Reset()
+	if err := cif.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "a[1]\n") {
+		t.Fatalf("CIF 1.1 output should not quote 'a[1]':\n%s", buf)
+	}
+}